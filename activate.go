@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// activateLine returns the shell command that adds path to the front of the
+// KUBECONFIG chain. Since the first file to set current-context wins, this
+// makes the exploded context current while keeping the rest of the chain.
+// The value is quoted so paths with spaces or shell metacharacters are safe
+// to eval.
+func activateLine(path string) string {
+	chain := filepath.SplitList(os.Getenv(clientcmd.RecommendedConfigPathEnvVar))
+	if len(chain) == 0 {
+		chain = []string{clientcmd.RecommendedHomeFile}
+	}
+
+	chain = slices.DeleteFunc(chain, func(p string) bool { return p == path || len(p) == 0 })
+	chain = append([]string{path}, chain...)
+
+	return "export " + clientcmd.RecommendedConfigPathEnvVar + "=" + shellQuote(strings.Join(chain, string(filepath.ListSeparator)))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ageSuffix is appended to the destination of files written with
+// --encrypt-age, and marks encrypted files picked up by --kubeconfig-dir with
+// --decrypt-age.
+const ageSuffix = ".age"
+
+// ageMagic starts every binary age file.
+const ageMagic = "age-encryption.org/"
+
+// parseAgeRecipients parses the --encrypt-age recipients.
+func parseAgeRecipients(recipients []string) ([]age.Recipient, error) {
+	parsed, err := age.ParseRecipients(strings.NewReader(strings.Join(recipients, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --encrypt-age recipient: %w", err)
+	}
+	return parsed, nil
+}
+
+// parseAgeIdentities reads the identities in the --decrypt-age file.
+func parseAgeIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read --decrypt-age identities: %w", err)
+	}
+	defer f.Close()
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --decrypt-age identities %q: %w", path, err)
+	}
+	return identities, nil
+}
+
+// encryptAge encrypts content to recipients in the binary age format.
+func encryptAge(content []byte, recipients []age.Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decryptAge decrypts binary or armored age data, and returns data as is if
+// it isn't encrypted.
+func decryptAge(data []byte, identities []age.Identity) ([]byte, error) {
+	var r io.Reader
+	switch {
+	case bytes.HasPrefix(data, []byte(ageMagic)):
+		r = bytes.NewReader(data)
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)):
+		r = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	default:
+		return data, nil
+	}
+
+	dr, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(bufio.NewReader(dr))
+}
+
+// loadDecrypted loads and merges the kubeconfig files in paths the way
+// clientcmd does, decrypting those encrypted with age first. Missing files
+// are skipped.
+func loadDecrypted(paths []string, identities []age.Identity) (*clientcmdapi.Config, error) {
+	merged := clientcmdapi.NewConfig()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %q: %w", path, err)
+		}
+
+		if data, err = decryptAge(data, identities); err != nil {
+			return nil, fmt.Errorf("unable to decrypt %q: %w", path, err)
+		}
+
+		cfg, err := clientcmd.Load(data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load %q: %w", path, err)
+		}
+		for _, context := range cfg.Contexts {
+			context.LocationOfOrigin = path
+		}
+		for _, cluster := range cfg.Clusters {
+			cluster.LocationOfOrigin = path
+		}
+		for _, auth := range cfg.AuthInfos {
+			auth.LocationOfOrigin = path
+		}
+		if err := clientcmd.ResolveLocalPaths(cfg); err != nil {
+			return nil, fmt.Errorf("unable to resolve paths in %q: %w", path, err)
+		}
+
+		mergeMissing(merged.Clusters, cfg.Clusters)
+		mergeMissing(merged.AuthInfos, cfg.AuthInfos)
+		mergeMissing(merged.Contexts, cfg.Contexts)
+		mergeMissing(merged.Extensions, cfg.Extensions)
+		if len(merged.CurrentContext) == 0 {
+			merged.CurrentContext = cfg.CurrentContext
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultAnnotationExtension is the top-level extension --annotate stores its
+// key/value pairs in.
+const defaultAnnotationExtension = "annotations"
+
+// parseAnnotations parses the key=value pairs given to --annotate. Values may
+// contain any character, including '=' and ','.
+func parseAnnotations(pairs []string) (map[string]string, error) {
+	annotations := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || len(key) == 0 {
+			return nil, fmt.Errorf("invalid --annotate %q, must be key=value", pair)
+		}
+		annotations[key] = value
+	}
+	return annotations, nil
+}
+
+// annotate stores annotations in the top-level extension of cfg, keeping the
+// fields the extension may already have. The extensions map of cfg is copied
+// first, as it is shared with the source config.
+func annotate(cfg *clientcmdapi.Config, extension string, annotations map[string]string) error {
+	fields, ok := extensionFields(cfg.Extensions[extension])
+	if !ok {
+		fields = make(map[string]any, len(annotations))
+	}
+	for key, value := range annotations {
+		fields[key] = value
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	extensions := maps.Clone(cfg.Extensions)
+	if extensions == nil {
+		extensions = make(map[string]runtime.Object, 1)
+	}
+	extensions[extension] = &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}
+	cfg.Extensions = extensions
+	return nil
+}
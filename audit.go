@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// kubectlCacheDirs are the directories kubectl keeps its discovery and HTTP
+// caches in below the kube config directory. They hold no credentials and are
+// managed by kubectl, so the audit leaves them alone.
+var kubectlCacheDirs = []string{"cache", "http-cache"}
+
+// auditPerms reports regular files in the output directory that are
+// readable or writable by group or others, fixing them with --fix-perms.
+// kubectl's cache directories are skipped.
+func auditPerms(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	dir := outputDir()
+
+	var broad int
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && filepath.Dir(path) == dir && slices.Contains(kubectlCacheDirs, d.Name()) {
+			return fs.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		mode := info.Mode().Perm()
+		if mode&0077 == 0 {
+			return nil
+		}
+
+		if opts.fixPerms {
+			if err := os.Chmod(path, mode&^0077); err != nil {
+				return fmt.Errorf("unable to fix permissions of %q: %w", path, err)
+			}
+			logger.Printf("fixed permissions of %q from %#o to %#o", path, mode, mode&^0077)
+			return nil
+		}
+
+		logger.Printf("warning: %q has permissions %#o which are broader than 0600", path, mode)
+		broad++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if broad > 0 {
+		return fmt.Errorf("found %d files in %q with permissions broader than 0600, use --fix-perms to fix them", broad, dir)
+	}
+
+	return nil
+}
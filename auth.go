@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Auth methods accepted by --keep-auth.
+const (
+	authToken      = "token"
+	authClientCert = "clientcert"
+	authExec       = "exec"
+	authBasic      = "basic"
+)
+
+var authMethods = []string{authToken, authClientCert, authExec, authBasic}
+
+// keepAuthMethod returns a copy of auth with the credentials of every method
+// other than method cleared. It fails if auth has no credentials for method.
+func keepAuthMethod(auth *clientcmdapi.AuthInfo, method string) (*clientcmdapi.AuthInfo, error) {
+	if !hasAuthMethod(auth, method) {
+		return nil, fmt.Errorf("authinfo has no %s credentials", method)
+	}
+
+	out := auth.DeepCopy()
+	if method != authToken {
+		out.Token, out.TokenFile = "", ""
+	}
+	if method != authClientCert {
+		out.ClientCertificate, out.ClientCertificateData = "", nil
+		out.ClientKey, out.ClientKeyData = "", nil
+	}
+	if method != authExec {
+		out.Exec = nil
+	}
+	if method != authBasic {
+		out.Username, out.Password = "", ""
+	}
+	out.AuthProvider = nil
+
+	return out, nil
+}
+
+// hasAuthMethod reports whether auth has credentials for method.
+func hasAuthMethod(auth *clientcmdapi.AuthInfo, method string) bool {
+	switch method {
+	case authToken:
+		return len(auth.Token) > 0 || len(auth.TokenFile) > 0
+	case authClientCert:
+		return (len(auth.ClientCertificate) > 0 || len(auth.ClientCertificateData) > 0) &&
+			(len(auth.ClientKey) > 0 || len(auth.ClientKeyData) > 0)
+	case authExec:
+		return auth.Exec != nil
+	case authBasic:
+		return len(auth.Username) > 0
+	}
+	return false
+}
+
+// authInfoMethods returns the auth methods auth has credentials for,
+// including an auth provider as auth-provider:<name>.
+func authInfoMethods(auth *clientcmdapi.AuthInfo) []string {
+	methods := []string{}
+	for _, method := range authMethods {
+		if hasAuthMethod(auth, method) {
+			methods = append(methods, method)
+		}
+	}
+	if auth.AuthProvider != nil {
+		methods = append(methods, "auth-provider:"+auth.AuthProvider.Name)
+	}
+	return methods
+}
+
+// freezeExecEnv returns a copy of auth whose exec config carries explicit env
+// entries for every environment variable referenced by its command, args or
+// env values, resolved from the current environment. The names of the frozen
+// variables are returned as well.
+func freezeExecEnv(auth *clientcmdapi.AuthInfo) (*clientcmdapi.AuthInfo, []string) {
+	if auth.Exec == nil {
+		return auth, nil
+	}
+
+	referenced := make(map[string]bool)
+	collect := func(s string) {
+		os.Expand(s, func(name string) string {
+			referenced[name] = true
+			return ""
+		})
+	}
+	collect(auth.Exec.Command)
+	for _, arg := range auth.Exec.Args {
+		collect(arg)
+	}
+	for _, env := range auth.Exec.Env {
+		collect(env.Value)
+	}
+	for _, env := range auth.Exec.Env {
+		delete(referenced, env.Name)
+	}
+
+	out := auth.DeepCopy()
+	var frozen []string
+	for _, name := range slices.Sorted(maps.Keys(referenced)) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		out.Exec.Env = append(out.Exec.Env, clientcmdapi.ExecEnvVar{Name: name, Value: value})
+		frozen = append(frozen, name)
+	}
+
+	return out, frozen
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// loadBaseline loads the kubeconfig at path with the same path resolution
+// applied to the source config, so the two compare equal when unchanged.
+func loadBaseline(path string) (*clientcmdapi.Config, error) {
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: path}
+	return rules.Load()
+}
+
+// contextChanged reports whether contextName is new in cfg or differs from
+// baseline in its context, cluster or authinfo definition.
+func contextChanged(cfg, baseline *clientcmdapi.Config, contextName string) bool {
+	context, baseContext := cfg.Contexts[contextName], baseline.Contexts[contextName]
+	if context == nil || baseContext == nil {
+		return true
+	}
+
+	return !sameContext(context, baseContext) ||
+		!sameCluster(cfg.Clusters[context.Cluster], baseline.Clusters[baseContext.Cluster]) ||
+		!sameAuthInfo(cfg.AuthInfos[context.AuthInfo], baseline.AuthInfos[baseContext.AuthInfo])
+}
+
+// The same* functions compare two definitions without regard to which file
+// they were loaded from.
+
+func sameContext(a, b *clientcmdapi.Context) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	a, b = a.DeepCopy(), b.DeepCopy()
+	a.LocationOfOrigin, b.LocationOfOrigin = "", ""
+	return reflect.DeepEqual(a, b)
+}
+
+func sameCluster(a, b *clientcmdapi.Cluster) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	a, b = a.DeepCopy(), b.DeepCopy()
+	a.LocationOfOrigin, b.LocationOfOrigin = "", ""
+	return reflect.DeepEqual(a, b)
+}
+
+func sameAuthInfo(a, b *clientcmdapi.AuthInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	a, b = a.DeepCopy(), b.DeepCopy()
+	a.LocationOfOrigin, b.LocationOfOrigin = "", ""
+	return reflect.DeepEqual(a, b)
+}
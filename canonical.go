@@ -0,0 +1,57 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// canonicalize re-emits serialized YAML with sorted mapping keys, double
+// quotes for every quoted scalar and two-space indentation, so output does not
+// change with the serializer clientcmd happens to use.
+func canonicalize(content []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("unable to canonicalize config: %w", err)
+	}
+	canonicalizeNode(&doc)
+
+	out, err := encodeYAML(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to canonicalize config: %w", err)
+	}
+
+	return out, nil
+}
+
+func canonicalizeNode(n *yaml.Node) {
+	// Scalars are only quoted when the serializer found it necessary, e.g. for
+	// strings a YAML 1.1 parser would read as booleans, so keep them quoted.
+	if n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) != 0 {
+		n.Style = yaml.DoubleQuotedStyle
+	} else {
+		n.Style = 0
+	}
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+
+	for _, c := range n.Content {
+		canonicalizeNode(c)
+	}
+
+	if n.Kind == yaml.MappingNode {
+		pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+		}
+		slices.SortStableFunc(pairs, func(a, b [2]*yaml.Node) int {
+			return cmp.Compare(a[0].Value, b[0].Value)
+		})
+
+		n.Content = n.Content[:0]
+		for _, pair := range pairs {
+			n.Content = append(n.Content, pair[0], pair[1])
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// confirmWrites summarizes what writing outputs will do and asks for
+// confirmation on the terminal, failing unless the answer is yes.
+func (e *exploder) confirmWrites(outputs []output) error {
+	counts := make(map[string]int)
+	dirs := make(map[string]bool)
+	for _, out := range outputs {
+		entry, err := planWrite(e.opts, out.context, out.path, out.content)
+		if err != nil {
+			return err
+		}
+		counts[entry.Action]++
+		dirs[filepath.Dir(out.path)] = true
+	}
+
+	where := fmt.Sprintf("%d directories", len(dirs))
+	if len(dirs) == 1 {
+		for dir := range dirs {
+			where = dir
+		}
+	}
+
+	// Never wait on a prompt nobody can answer.
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("--confirm requires an interactive terminal on stdin")
+	}
+
+	prompt := e.logger.Writer()
+	fmt.Fprintf(prompt, "will write %d files to %s (%d new, %d overwritten), %d exist and will be skipped\n",
+		counts[actionCreate]+counts[actionOverwrite], where, counts[actionCreate], counts[actionOverwrite], counts[actionSkip])
+	fmt.Fprint(prompt, "continue? [y/N] ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.New("aborted")
+}
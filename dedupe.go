@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// sameResolvedContext reports whether contexts a and b of cfg resolve to the
+// same definitions, even if they reference their cluster and authinfo by
+// different names, as happens when merged sources overlap.
+func sameResolvedContext(cfg *clientcmdapi.Config, a, b string) bool {
+	contextA, contextB := cfg.Contexts[a], cfg.Contexts[b]
+	if contextA == nil || contextB == nil {
+		return false
+	}
+
+	if !sameCluster(cfg.Clusters[contextA.Cluster], cfg.Clusters[contextB.Cluster]) ||
+		!sameAuthInfo(cfg.AuthInfos[contextA.AuthInfo], cfg.AuthInfos[contextB.AuthInfo]) {
+		return false
+	}
+
+	contextA, contextB = contextA.DeepCopy(), contextB.DeepCopy()
+	contextA.Cluster, contextB.Cluster = "", ""
+	contextA.AuthInfo, contextB.AuthInfo = "", ""
+	return sameContext(contextA, contextB)
+}
+
+// dedupeContexts drops contexts from todo that resolve to the same
+// definitions as an earlier one, returning the kept contexts and the
+// duplicates collapsed into each of them.
+func dedupeContexts(cfg *clientcmdapi.Config, todo []string) ([]string, map[string][]string) {
+	var kept []string
+	aliases := make(map[string][]string)
+	for _, contextName := range todo {
+		i := slices.IndexFunc(kept, func(keptName string) bool {
+			return sameResolvedContext(cfg, keptName, contextName)
+		})
+		if i < 0 {
+			kept = append(kept, contextName)
+			continue
+		}
+		aliases[kept[i]] = append(aliases[kept[i]], contextName)
+	}
+
+	return kept, aliases
+}
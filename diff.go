@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// maxSkipDiffLines caps the diff printed by --show-diff-on-skip so a single
+// stale file can't drown out the rest of the run.
+const maxSkipDiffLines = 40
+
+// logSkipDiff reports whether the skipped file at path, shown as name,
+// matches content and, if it doesn't, a unified diff of what writing it would
+// change.
+func logSkipDiff(path, name string, content []byte, logger *log.Logger) {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		logger.Printf("unable to diff file %q: %v", name, err)
+		return
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(existing)),
+		B:        difflib.SplitLines(string(content)),
+		FromFile: name,
+		ToFile:   "exploded",
+		Context:  1,
+	})
+	if err != nil {
+		logger.Printf("unable to diff file %q: %v", name, err)
+		return
+	}
+	if len(diff) == 0 {
+		logger.Printf("file %q matches what would be written", name)
+		return
+	}
+
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	if len(lines) > maxSkipDiffLines {
+		lines = append(lines[:maxSkipDiffLines], fmt.Sprintf("... %d more lines", len(lines)-maxSkipDiffLines))
+	}
+	logger.Printf("file %q differs from what would be written:\n%s", name, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,1019 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"filippo.io/age"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Errors returned by selectContexts and explodeContext when a named context or
+// one of the entries it references is missing. Use errors.Is to tell them apart.
+var (
+	ErrContextNotFound  = errors.New("context not found")
+	ErrClusterNotFound  = errors.New("cluster not found")
+	ErrAuthInfoNotFound = errors.New("authinfo not found")
+)
+
+// notFoundError wraps one of the Err*NotFound sentinels with the name that was
+// looked up.
+type notFoundError struct {
+	err  error
+	kind string
+	name string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("cannot find %s %q", e.kind, e.name)
+}
+
+func (e *notFoundError) Unwrap() error {
+	return e.err
+}
+
+// exploder carries the state of a single explode run.
+type exploder struct {
+	opts   *options
+	stdout io.Writer
+	logger *log.Logger
+
+	header      *template.Template
+	selector    labels.Selector
+	usedSince   time.Time
+	footer      *template.Template
+	renderTmpl  *template.Template
+	comment     []byte
+	aggregate   map[string]json.RawMessage
+	recipients  []age.Recipient
+	names       map[string]string
+	annotations map[string]string
+	maxFileSize int64
+	mode        os.FileMode
+	merged      *clientcmdapi.Config
+	shared      *sharedKeys
+	authFrom    *clientcmdapi.Config
+	passthrough *passthroughSource
+	plan        []planEntry
+	written     []string
+	hookErrors  int
+	gitRepo     string
+
+	// decisions records why each context was or wasn't selected for
+	// --explain. Later rules overwrite the decisions of earlier ones.
+	decisions map[string]string
+}
+
+// output is a single exploded config on its way to its destination.
+type output struct {
+	context string
+	path    string
+	cfg     *clientcmdapi.Config
+	content []byte
+	mode    os.FileMode
+}
+
+func explode(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	e := &exploder{opts: opts, stdout: stdout, logger: logger}
+	return e.run(args)
+}
+
+// run explodes the contexts selected by args, recording the files it wrote in
+// e.written.
+func (e *exploder) run(args []string) error {
+	opts, stdout, logger := e.opts, e.stdout, e.logger
+	if err := validateExplodeOptions(opts, args); err != nil {
+		return err
+	}
+
+	if err := e.parseOptions(); err != nil {
+		return err
+	}
+	if opts.aggregate {
+		e.aggregate = make(map[string]json.RawMessage)
+	}
+
+	cfg, err := loadConfig(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Contexts) == 0 {
+		return errors.New("no contexts found")
+	}
+
+	todo, err := e.selectContexts(&cfg, args)
+	if err != nil {
+		return err
+	}
+
+	if opts.normalizeServer {
+		warnServerCollisions(&cfg, todo, logger)
+	}
+
+	if opts.single && len(todo) != 1 {
+		return fmt.Errorf("--single requires exactly one selected context, got %d", len(todo))
+	}
+
+	if opts.requireNamespace && len(opts.perNamespace) == 0 && len(opts.defaultNamespace) == 0 {
+		var missing []string
+		for _, contextName := range todo {
+			if len(cfg.Contexts[contextName].Namespace) == 0 {
+				missing = append(missing, contextName)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("--require-namespace: contexts without a namespace: %s", strings.Join(missing, ", "))
+		}
+	}
+
+	if opts.passthroughSingle {
+		if e.passthrough, err = loadPassthroughSource(opts, &cfg, todo); err != nil {
+			return fmt.Errorf("--passthrough-single: %w", err)
+		}
+		if e.passthrough == nil {
+			logger.Print("--passthrough-single: the source is not a single kubeconfig file holding only the selected context, re-serializing it")
+		}
+	}
+
+	if e.names, err = fileNames(&cfg, todo, opts); err != nil {
+		return err
+	}
+
+	if (!opts.stdout || len(opts.tee) > 0) && len(opts.mergeInto) == 0 {
+		if err := e.checkDestinations(todo); err != nil {
+			return err
+		}
+	}
+
+	if len(opts.mergeInto) > 0 {
+		e.merged, err = loadMergeTarget(opts.mergeInto)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(opts.authFrom) > 0 {
+		e.authFrom, err = (&clientcmd.ClientConfigLoadingRules{ExplicitPath: opts.authFrom}).Load()
+		if err != nil {
+			return fmt.Errorf("unable to load --auth-from %q: %w", opts.authFrom, err)
+		}
+	}
+
+	if opts.reuseKeys {
+		e.shared = newSharedKeys(&cfg, todo, filepath.Join(outputDir(), "shared"), newSanitizer(opts))
+	}
+
+	// Explode and serialize everything before writing anything, so a bad
+	// context doesn't leave a partially written set behind.
+	var outputs []output
+	for _, contextName := range todo {
+		outCfg, err := explodeContext(&cfg, e.authFrom, contextName, opts, logger)
+		if err != nil {
+			return err
+		}
+		if e.annotations != nil {
+			if err := annotate(outCfg, opts.annotationExtension, e.annotations); err != nil {
+				return fmt.Errorf("unable to annotate context %q: %w", contextName, err)
+			}
+		}
+
+		if e.merged != nil {
+			if err := mergeConfig(e.merged, outCfg, opts.onConflict, logger); err != nil {
+				return fmt.Errorf("unable to merge context %q into %q: %w", contextName, opts.mergeInto, err)
+			}
+			e.plan = append(e.plan, planEntry{Context: contextName, Path: opts.mergeInto, Action: actionMerge})
+			continue
+		}
+
+		mode, err := e.contextMode(cfg.Contexts[contextName])
+		if err != nil {
+			return fmt.Errorf("context %q: %w", contextName, err)
+		}
+		for _, out := range e.variants(contextName, outCfg) {
+			out.mode = mode
+			outputs = append(outputs, out)
+		}
+	}
+
+	if err := e.prepareAll(outputs); err != nil {
+		return err
+	}
+
+	if !opts.allowOverwriteSource && !opts.keychain && e.merged == nil && (!opts.stdout || len(opts.tee) > 0) {
+		if err := checkSourceOverwrites(&cfg, e.destinations(outputs)); err != nil {
+			return err
+		}
+	}
+
+	if opts.preflight {
+		if err := printPreflight(stdout, opts, outputs); err != nil {
+			return err
+		}
+		if opts.dryRun {
+			return nil
+		}
+	}
+
+	if opts.gitCommit {
+		// Fail before writing anything rather than leaving uncommitted files
+		// behind.
+		if e.gitRepo, err = gitRepository(slices.Sorted(maps.Keys(e.destinations(outputs)))); err != nil {
+			return err
+		}
+	}
+
+	if opts.confirm && !opts.dryRun {
+		if err := e.confirmWrites(outputs); err != nil {
+			return err
+		}
+	}
+
+	if e.shared != nil {
+		if err := e.emitShared(); err != nil {
+			return err
+		}
+	}
+	for _, out := range outputs {
+		if err := e.emit(out); err != nil {
+			return err
+		}
+	}
+
+	if opts.dryRun {
+		if opts.gitCommit {
+			if err := e.gitCommit(); err != nil {
+				return err
+			}
+		}
+		return printPlan(stdout, opts, e.plan)
+	}
+
+	if e.aggregate != nil {
+		if err := writeAggregate(stdout, e.aggregate); err != nil {
+			return err
+		}
+	}
+
+	if len(opts.index) > 0 {
+		if err := writeIndex(opts.index, outputs); err != nil {
+			return fmt.Errorf("unable to write --index %q: %w", opts.index, err)
+		}
+	}
+
+	if len(opts.emitSwitcher) > 0 {
+		if err := writeSwitcher(opts.emitSwitcher, outputs); err != nil {
+			return fmt.Errorf("unable to write --emit-switcher %q: %w", opts.emitSwitcher, err)
+		}
+	}
+
+	if e.merged != nil {
+		if err := clientcmd.WriteToFile(*e.merged, opts.mergeInto); err != nil {
+			return err
+		}
+		e.written = append(e.written, opts.mergeInto)
+	}
+
+	if opts.gitCommit {
+		if err := e.gitCommit(); err != nil {
+			return err
+		}
+	}
+
+	if opts.emitKubeconfigEnv {
+		if err := e.printKubeconfigEnv(outputs); err != nil {
+			return err
+		}
+	}
+
+	if e.hookErrors > 0 && !opts.ignoreHookErrors {
+		return fmt.Errorf("post-write hook failed for %d files, use --ignore-hook-errors to ignore", e.hookErrors)
+	}
+
+	return nil
+}
+
+// validateExplodeOptions rejects invalid or conflicting flag combinations
+// before anything is loaded.
+func validateExplodeOptions(opts *options, args []string) error {
+	if !opts.allContexts && len(opts.selector) == 0 && len(args) == 0 {
+		return errors.New("must specify context names, --all or --selector")
+	}
+	if opts.single && !opts.stdout {
+		return errors.New("--single requires --stdout")
+	}
+	if len(opts.mergeInto) > 0 && opts.stdout {
+		return errors.New("--merge-into cannot be used with --stdout")
+	}
+	if !slices.Contains(conflictStrategies, opts.onConflict) {
+		return fmt.Errorf("invalid --on-conflict %q, must be one of %s", opts.onConflict, strings.Join(conflictStrategies, ", "))
+	}
+	if opts.keychain && (opts.stdout || len(opts.mergeInto) > 0 || opts.activate || opts.reuseKeys || opts.preflight || len(opts.perNamespace) > 0) {
+		return errors.New("--keychain cannot be used with --stdout, --merge-into, --activate, --reuse-keys, --preflight or --per-namespace")
+	}
+	if (len(opts.render) > 0) != (len(opts.renderOut) > 0) {
+		return errors.New("--render and --render-out must be used together")
+	}
+	if len(opts.render) > 0 && (opts.stdout || opts.keychain || len(opts.mergeInto) > 0 || opts.activate || opts.emitKubeconfigEnv) {
+		return errors.New("--render cannot be used with --stdout, --keychain, --merge-into, --activate or --emit-kubeconfig-env")
+	}
+	if opts.format != formatYAML && opts.format != formatJSON {
+		return fmt.Errorf("invalid --format %q, must be %s or %s", opts.format, formatYAML, formatJSON)
+	}
+	if opts.format == formatJSON && (opts.asSecret || opts.yamlDocumentStart || len(opts.headerComment) > 0 || len(opts.headerFile) > 0) {
+		return errors.New("--format json cannot be used with --as-secret, --yaml-document-start, --header or --header-file")
+	}
+	if opts.aggregate && (!opts.stdout || opts.format != formatJSON || opts.base64 || len(opts.stdoutHeader) > 0 || len(opts.stdoutFooter) > 0 || len(opts.perNamespace) > 0) {
+		return errors.New("--aggregate requires --stdout and --format json, and cannot be used with --base64, --stdout-header, --stdout-footer or --per-namespace")
+	}
+	if !slices.Contains(nameFields, opts.nameFrom) {
+		return fmt.Errorf("invalid --name-from %q, must be one of %s", opts.nameFrom, strings.Join(nameFields, ", "))
+	}
+	if len(opts.headerComment) > 0 && len(opts.headerFile) > 0 {
+		return errors.New("--header and --header-file are mutually exclusive")
+	}
+	if len(opts.tee) > 0 && !opts.stdout {
+		return errors.New("--tee requires --stdout")
+	}
+	if opts.base64 && !opts.stdout {
+		return errors.New("--base64 requires --stdout since base64 encoded files are not valid kubeconfigs")
+	}
+	if opts.emitKubeconfigEnv && (opts.stdout || opts.keychain) {
+		return errors.New("--emit-kubeconfig-env cannot be used with --stdout or --keychain")
+	}
+	if opts.activate && (opts.allContexts || len(args) != 1 || opts.stdout || len(opts.mergeInto) > 0) {
+		return errors.New("--activate requires a single context written to a file")
+	}
+	if len(opts.perNamespace) > 0 && (opts.allContexts || len(args) != 1 || len(opts.mergeInto) > 0) {
+		return errors.New("--per-namespace requires a single context and cannot be used with --merge-into")
+	}
+	if opts.noClobberDifferent && (opts.force || opts.replace) {
+		return errors.New("--no-clobber-different cannot be used with --force or --replace-existing")
+	}
+	if opts.failOnOverwrite && (opts.force || opts.replace) {
+		return errors.New("--fail-on-overwrite cannot be used with --force or --replace-existing")
+	}
+	if opts.onlyClusters && opts.onlyUsers {
+		return errors.New("--only-clusters and --only-users are mutually exclusive")
+	}
+	if (opts.onlyClusters || opts.onlyUsers) && (len(opts.mergeInto) > 0 || len(opts.perNamespace) > 0 || opts.activate) {
+		return errors.New("--only-clusters and --only-users cannot be used with --merge-into, --per-namespace or --activate")
+	}
+	if opts.reuseKeys && (!opts.allContexts || opts.stdout || len(opts.mergeInto) > 0) {
+		return errors.New("--reuse-keys requires --all and cannot be used with --stdout or --merge-into")
+	}
+	if len(opts.keepAuth) > 0 && !slices.Contains(authMethods, opts.keepAuth) {
+		return fmt.Errorf("invalid --keep-auth %q, must be one of %s", opts.keepAuth, strings.Join(authMethods, ", "))
+	}
+	if len(opts.replaceChar) == 0 || strings.ContainsAny(opts.replaceChar, `/\`) {
+		return fmt.Errorf("invalid --replace-char %q, must not be empty or a path separator", opts.replaceChar)
+	}
+	if (len(opts.index) > 0 || len(opts.emitSwitcher) > 0) && (opts.stdout || opts.keychain || len(opts.mergeInto) > 0 || len(opts.render) > 0) {
+		return errors.New("--index and --emit-switcher cannot be used with --stdout, --keychain, --merge-into or --render")
+	}
+	if len(opts.encryptAge) > 0 && (opts.stdout || opts.keychain || len(opts.mergeInto) > 0 || len(opts.render) > 0 || opts.reuseKeys || opts.activate || opts.emitKubeconfigEnv || len(opts.emitSwitcher) > 0) {
+		return errors.New("--encrypt-age cannot be used with --stdout, --keychain, --merge-into, --render, --reuse-keys, --activate, --emit-kubeconfig-env or --emit-switcher")
+	}
+	if opts.gitCommit && ((opts.stdout && len(opts.tee) == 0) || opts.keychain) {
+		return errors.New("--git-commit requires files to be written and cannot be used with --stdout without --tee or --keychain")
+	}
+	if opts.confirm && (opts.stdout || opts.keychain || len(opts.mergeInto) > 0) {
+		return errors.New("--confirm cannot be used with --stdout, --keychain or --merge-into")
+	}
+	if opts.preflight && (opts.stdout || len(opts.mergeInto) > 0) {
+		return errors.New("--preflight cannot be used with --stdout or --merge-into")
+	}
+	if opts.writeRetries < 0 {
+		return fmt.Errorf("invalid --write-retries %d, must not be negative", opts.writeRetries)
+	}
+	if opts.concurrency < 1 {
+		return fmt.Errorf("invalid --concurrency %d, must be at least 1", opts.concurrency)
+	}
+	if opts.limit < 0 {
+		return fmt.Errorf("invalid --limit %d, must not be negative", opts.limit)
+	}
+	if opts.output != outputText && opts.output != outputJSON {
+		return fmt.Errorf("invalid --output %q, must be %s or %s", opts.output, outputText, outputJSON)
+	}
+
+	return nil
+}
+
+// parseOptions parses flag values that need more than a type conversion.
+func (e *exploder) parseOptions() error {
+	var err error
+	if e.header, err = parseStdoutTemplate("stdout-header", e.opts.stdoutHeader); err != nil {
+		return err
+	}
+	if e.footer, err = parseStdoutTemplate("stdout-footer", e.opts.stdoutFooter); err != nil {
+		return err
+	}
+
+	text := e.opts.headerComment
+	if len(e.opts.headerFile) > 0 {
+		data, err := os.ReadFile(e.opts.headerFile)
+		if err != nil {
+			return fmt.Errorf("unable to read --header-file: %w", err)
+		}
+		text = string(data)
+	}
+	e.comment = yamlComment(text)
+
+	if len(e.opts.render) > 0 {
+		if e.renderTmpl, err = parseRenderTemplate(e.opts.render); err != nil {
+			return err
+		}
+	}
+
+	if len(e.opts.selector) > 0 {
+		if e.selector, err = parseSelector(e.opts.selector); err != nil {
+			return err
+		}
+	}
+
+	if len(e.opts.usedSince) > 0 {
+		d, err := parseSince(e.opts.usedSince)
+		if err != nil {
+			return err
+		}
+		e.usedSince = time.Now().Add(-d)
+	}
+
+	if len(e.opts.encryptAge) > 0 {
+		if e.recipients, err = parseAgeRecipients(e.opts.encryptAge); err != nil {
+			return err
+		}
+	}
+
+	if len(e.opts.annotate) > 0 {
+		if e.annotations, err = parseAnnotations(e.opts.annotate); err != nil {
+			return err
+		}
+	}
+
+	if e.mode, err = parseFileMode(e.opts.mode); err != nil {
+		return fmt.Errorf("invalid --mode: %w", err)
+	}
+
+	if len(e.opts.maxFileSize) > 0 {
+		q, err := resource.ParseQuantity(e.opts.maxFileSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-file-size %q: %w", e.opts.maxFileSize, err)
+		}
+		e.maxFileSize = q.Value()
+	}
+
+	return nil
+}
+
+// selectContexts resolves the contexts to explode.
+func (e *exploder) selectContexts(cfg *clientcmdapi.Config, args []string) ([]string, error) {
+	todo := make([]string, 0, len(args))
+
+	e.decisions = make(map[string]string, len(cfg.Contexts))
+	for contextName := range cfg.Contexts {
+		e.decisions[contextName] = "excluded, not named on the command line"
+	}
+
+	// Ensure that all specified contexts are present before writing out any files
+	if !e.opts.allContexts && len(args) > 0 {
+		for _, contextName := range args {
+			if _, ok := cfg.Contexts[contextName]; !ok {
+				return nil, &notFoundError{err: ErrContextNotFound, kind: "context", name: contextName}
+			}
+
+			todo = append(todo, contextName)
+			e.decisions[contextName] = "included by positional argument"
+		}
+	} else {
+		reason := "included by --all"
+		if !e.opts.allContexts {
+			reason = "included by --selector " + e.opts.selector
+		}
+
+		todo = slices.Sorted(maps.Keys(cfg.Contexts))
+		for _, contextName := range todo {
+			e.decisions[contextName] = reason
+		}
+	}
+
+	if e.selector != nil {
+		todo = slices.DeleteFunc(todo, func(contextName string) bool {
+			if e.selector.Matches(contextLabels(cfg.Contexts[contextName], e.opts.labelExtension)) {
+				return false
+			}
+			e.decisions[contextName] = "excluded by --selector " + e.opts.selector
+			return true
+		})
+	}
+
+	if !e.usedSince.IsZero() {
+		todo = slices.DeleteFunc(todo, func(contextName string) bool {
+			lastUsed, ok := contextLastUsed(cfg.Contexts[contextName], e.opts.lastUsedExtension)
+			switch {
+			case !ok && e.opts.includeMissingTimestamp:
+				return false
+			case !ok:
+				e.decisions[contextName] = "excluded by --used-since, no last-used timestamp"
+				return true
+			case lastUsed.Before(e.usedSince):
+				e.decisions[contextName] = "excluded by --used-since, last used " + lastUsed.Format(time.RFC3339)
+				return true
+			}
+			return false
+		})
+	}
+
+	if len(e.opts.baseline) > 0 {
+		baseline, err := loadBaseline(e.opts.baseline)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load baseline %q: %w", e.opts.baseline, err)
+		}
+
+		todo = slices.DeleteFunc(todo, func(contextName string) bool {
+			if contextChanged(cfg, baseline, contextName) {
+				return false
+			}
+			e.logger.Printf("context %q is unchanged from baseline, skipping", contextName)
+			e.decisions[contextName] = "excluded by --baseline, unchanged since " + e.opts.baseline
+			return true
+		})
+	}
+
+	if e.opts.dedupeIdentical {
+		var aliases map[string][]string
+		todo, aliases = dedupeContexts(cfg, todo)
+		for _, contextName := range slices.Sorted(maps.Keys(aliases)) {
+			e.logger.Printf("context %q is identical to %s, exploding it once", contextName, strings.Join(aliases[contextName], ", "))
+			for _, alias := range aliases[contextName] {
+				e.decisions[alias] = fmt.Sprintf("excluded by --dedupe-identical, identical to %q", contextName)
+			}
+		}
+	}
+
+	if e.opts.limit > 0 && len(todo) > e.opts.limit {
+		slices.Sort(todo)
+		for _, contextName := range todo[e.opts.limit:] {
+			e.decisions[contextName] = fmt.Sprintf("excluded by --limit %d", e.opts.limit)
+		}
+		todo = todo[:e.opts.limit]
+	}
+
+	if e.opts.explain {
+		for _, contextName := range slices.Sorted(maps.Keys(e.decisions)) {
+			e.logger.Printf("context %q: %s", contextName, e.decisions[contextName])
+		}
+	}
+
+	return todo, nil
+}
+
+// checkDestinations ensures no two selected contexts are written to the same
+// file, which sanitizing and --strip-prefix can otherwise cause, before
+// anything is written.
+func (e *exploder) checkDestinations(todo []string) error {
+	owners := make(map[string]string)
+	for _, contextName := range todo {
+		paths := []string{e.destination(contextName)}
+		if len(e.opts.perNamespace) > 0 {
+			paths = paths[:0]
+			for _, ns := range e.opts.perNamespace {
+				paths = append(paths, namespacedPath(e.destination(contextName), ns))
+			}
+		}
+
+		for _, path := range paths {
+			if owner, ok := owners[path]; ok && owner != contextName {
+				return fmt.Errorf("contexts %q and %q would both be written to %q", owner, contextName, path)
+			}
+			owners[path] = contextName
+		}
+	}
+
+	return nil
+}
+
+// destination returns the file contextName is written to, named after the
+// --name-from field of the context.
+func (e *exploder) destination(contextName string) string {
+	name, ok := e.names[contextName]
+	if !ok {
+		name = contextName
+	}
+	return destinationPath(e.opts, name)
+}
+
+// variants returns the outputs produced for an exploded context. This is the
+// context itself unless --per-namespace asks for one copy per namespace.
+func (e *exploder) variants(contextName string, cfg *clientcmdapi.Config) []output {
+	path := e.destination(contextName)
+	if len(e.opts.perNamespace) == 0 {
+		return []output{{context: contextName, path: path, cfg: cfg}}
+	}
+
+	outputs := make([]output, 0, len(e.opts.perNamespace))
+	for _, ns := range e.opts.perNamespace {
+		nsCfg := cfg.DeepCopy()
+		nsCfg.Contexts[contextName].Namespace = ns
+		outputs = append(outputs, output{context: contextName, path: namespacedPath(path, ns), cfg: nsCfg})
+	}
+	return outputs
+}
+
+// contextMode returns the mode the files of context are written with, which
+// is taken from its --mode-extension if present and --mode otherwise.
+func (e *exploder) contextMode(context *clientcmdapi.Context) (os.FileMode, error) {
+	ext, ok := context.Extensions[e.opts.modeExtension]
+	if !ok {
+		return e.mode, nil
+	}
+
+	value, ok := extensionString(ext, "mode")
+	if !ok {
+		return 0, fmt.Errorf("extension %q must hold a file mode", e.opts.modeExtension)
+	}
+	mode, err := parseFileMode(value)
+	if err != nil {
+		return 0, fmt.Errorf("extension %q: %w", e.opts.modeExtension, err)
+	}
+	return mode, nil
+}
+
+// namespacedPath returns the destination of a --per-namespace variant.
+func namespacedPath(path, ns string) string {
+	return path + "-" + ns
+}
+
+// prepareAll prepares outputs using up to --concurrency workers. Outputs keep
+// their order, so everything emitted afterwards is in selection order no
+// matter which serialization finishes first.
+func (e *exploder) prepareAll(outputs []output) error {
+	errs := make([]error, len(outputs))
+	sem := make(chan struct{}, max(e.opts.concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i := range outputs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			errs[i] = e.prepare(&outputs[i])
+		}()
+	}
+	wg.Wait()
+
+	// Report the error of the first failing output, as a sequential run
+	// would have.
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepare serializes out, checking the result against --max-file-size.
+func (e *exploder) prepare(out *output) error {
+	if e.shared != nil {
+		e.shared.extract(out.cfg)
+	}
+
+	content, err := e.serialize(*out)
+	if err != nil {
+		return err
+	}
+	if e.maxFileSize > 0 && int64(len(content)) > e.maxFileSize {
+		return fmt.Errorf("context %q is %d bytes which exceeds --max-file-size of %d bytes", out.context, len(content), e.maxFileSize)
+	}
+	out.content = content
+	if e.recipients != nil {
+		out.path += ageSuffix
+	}
+
+	if e.renderTmpl != nil {
+		// --render writes the rendered template in place of the config,
+		// through the same planning and exists checks.
+		if out.content, err = e.render(*out); err != nil {
+			return err
+		}
+		out.path = filepath.Join(e.opts.renderOut, filepath.Base(out.path))
+	}
+
+	return nil
+}
+
+// emit writes a prepared output to stdout or its destination file.
+func (e *exploder) emit(out output) error {
+	content := out.content
+
+	if e.opts.stdout {
+		e.plan = append(e.plan, planEntry{Context: out.context, Path: "-", Action: actionStdout})
+		switch {
+		case e.opts.dryRun:
+		case e.aggregate != nil:
+			// Written as a whole once every context has been emitted.
+			e.aggregate[out.context] = json.RawMessage(out.content)
+		default:
+			if err := e.writeStdout(out); err != nil {
+				return err
+			}
+		}
+		if len(e.opts.tee) == 0 {
+			return nil
+		}
+
+		// --tee saves what was streamed under the usual file name, going
+		// through the same exists checks as a regular write.
+		out.path = e.teePath(out.path)
+	}
+
+	if e.opts.keychain {
+		key := keychainKey(out)
+		e.plan = append(e.plan, planEntry{Context: out.context, Path: keychainService + "/" + key, Action: actionKeychain})
+		if e.opts.dryRun {
+			return nil
+		}
+		return storeInKeychain(key, content)
+	}
+
+	entry, err := planWrite(e.opts, out.context, out.path, content)
+	if err != nil {
+		return err
+	}
+	e.plan = append(e.plan, entry)
+	if e.opts.dryRun {
+		return nil
+	}
+
+	if err := writeConfig(e.opts, entry, content, out.mode, e.logger); err != nil {
+		return err
+	}
+	if entry.Action != actionSkip {
+		e.written = append(e.written, out.path)
+
+		if len(e.opts.postWriteHook) > 0 {
+			if err := e.runPostWriteHook(out.context, out.path); err != nil {
+				e.logger.Print(err)
+				e.hookErrors++
+			}
+		}
+	}
+
+	if e.opts.activate {
+		fmt.Fprintln(e.stdout, activateLine(out.path))
+	}
+
+	return nil
+}
+
+// emitShared writes the --reuse-keys shared files the prepared outputs
+// reference, going through the same planning as the outputs themselves.
+func (e *exploder) emitShared() error {
+	for _, file := range e.shared.pending() {
+		entry, err := planWrite(e.opts, file.context, file.path, file.data)
+		if err != nil {
+			return err
+		}
+		e.plan = append(e.plan, entry)
+		if e.opts.dryRun {
+			continue
+		}
+
+		if err := writeConfig(e.opts, entry, file.data, 0600, e.logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printKubeconfigEnv prints a KUBECONFIG value covering the files of
+// outputs, whether this run wrote them or skipped them as they already
+// existed. Nothing is printed without any such file, as evaluating an empty
+// value would clear the user's KUBECONFIG.
+func (e *exploder) printKubeconfigEnv(outputs []output) error {
+	var paths []string
+	if e.merged != nil {
+		paths = append(paths, e.opts.mergeInto)
+	}
+	for _, out := range outputs {
+		if _, err := os.Stat(out.path); err == nil && !slices.Contains(paths, out.path) {
+			paths = append(paths, out.path)
+		}
+	}
+
+	if len(paths) == 0 {
+		e.logger.Print("no exploded files to print a KUBECONFIG value for")
+		return nil
+	}
+
+	_, err := fmt.Fprintf(e.stdout, "%s=%s\n", clientcmd.RecommendedConfigPathEnvVar, shellQuote(strings.Join(paths, string(filepath.ListSeparator))))
+	return err
+}
+
+// teePath returns where --tee saves the output destined for path.
+func (e *exploder) teePath(path string) string {
+	return filepath.Join(e.opts.tee, filepath.Base(path))
+}
+
+// destinations returns the files outputs end up being written to, mapped to
+// the context written to each.
+func (e *exploder) destinations(outputs []output) map[string]string {
+	if e.merged != nil {
+		return map[string]string{e.opts.mergeInto: ""}
+	}
+
+	paths := make(map[string]string, len(outputs))
+	for _, out := range outputs {
+		if e.opts.stdout {
+			paths[e.teePath(out.path)] = out.context
+		} else {
+			paths[out.path] = out.context
+		}
+	}
+	return paths
+}
+
+// writeStdout streams a prepared output to stdout between the rendered
+// --stdout-header and --stdout-footer.
+func (e *exploder) writeStdout(out output) error {
+	content := out.content
+	if e.opts.base64 {
+		// One line per context, so the blob survives systems that mangle
+		// multi-line text. The config is recovered with base64 -d.
+		content = []byte(out.context + " " + base64.StdEncoding.EncodeToString(content) + "\n")
+	}
+
+	headerContent, err := renderStdoutTemplate(e.header, out.context)
+	if err != nil {
+		return err
+	}
+	footerContent, err := renderStdoutTemplate(e.footer, out.context)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(e.stdout, io.MultiReader(bytes.NewReader(headerContent), bytes.NewReader(content), bytes.NewReader(footerContent)))
+	return err
+}
+
+// serialize converts an exploded config into the bytes that are written out.
+func (e *exploder) serialize(out output) ([]byte, error) {
+	content, err := clientcmd.Write(*out.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.passthrough != nil {
+		// Keep the formatting and comments of a source that already is the
+		// exploded context, rather than churning it.
+		if bytes.Equal(content, e.passthrough.written) {
+			content = e.passthrough.raw
+		} else {
+			e.logger.Printf("--passthrough-single: context %q differs from its source once exploded, writing it re-serialized", out.context)
+		}
+	}
+
+	if e.opts.canonical {
+		content, err = canonicalize(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(e.opts.transform) > 0 {
+		content, err = e.transform(out.context, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.opts.asSecret {
+		content, err = wrapAsSecret(out.context, e.opts.secretNamespace, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.opts.format == formatJSON {
+		content, err = toJSON(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(e.comment) > 0 {
+		content = slices.Concat(e.comment, content)
+	}
+	if e.opts.yamlDocumentStart && !bytes.HasPrefix(content, []byte("---\n")) {
+		content = append([]byte("---\n"), content...)
+	}
+	if e.opts.noFinalNewline {
+		content = bytes.TrimRight(content, "\n")
+	}
+
+	if e.recipients != nil {
+		content, err = encryptAge(content, e.recipients)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encrypt context %q: %w", out.context, err)
+		}
+	}
+
+	return content, nil
+}
+
+// explodeContext copies contextName and the cluster and authinfo it
+// references from inCfg into a new config. Authinfos missing from inCfg are
+// looked up in authFrom, if given, before failing.
+func explodeContext(inCfg, authFrom *clientcmdapi.Config, contextName string, opts *options, logger *log.Logger) (*clientcmdapi.Config, error) {
+	context, ok := inCfg.Contexts[contextName]
+	if !ok || context == nil {
+		return nil, &notFoundError{err: ErrContextNotFound, kind: "context", name: contextName}
+	}
+
+	if len(context.Namespace) == 0 && len(opts.defaultNamespace) > 0 {
+		context = context.DeepCopy()
+		context.Namespace = opts.defaultNamespace
+	}
+
+	outCfg := clientcmdapi.NewConfig()
+	outCfg.Contexts[contextName] = context
+
+	server, ok := inCfg.Clusters[context.Cluster]
+	if !ok {
+		return nil, &notFoundError{err: ErrClusterNotFound, kind: "server", name: context.Cluster}
+	}
+	if opts.normalizeServer {
+		server = server.DeepCopy()
+		server.Server = normalizeServer(server.Server)
+	}
+	outCfg.Clusters[context.Cluster] = server
+
+	if server.InsecureSkipTLSVerify {
+		if opts.strictTLS {
+			return nil, fmt.Errorf("context %q uses cluster %q with insecure-skip-tls-verify", contextName, context.Cluster)
+		}
+		logger.Printf("warning: context %q uses cluster %q with insecure-skip-tls-verify", contextName, context.Cluster)
+	}
+
+	auth, ok := inCfg.AuthInfos[context.AuthInfo]
+	if !ok && authFrom != nil {
+		auth, ok = authFrom.AuthInfos[context.AuthInfo]
+	}
+	if !ok {
+		return nil, &notFoundError{err: ErrAuthInfoNotFound, kind: "authinfo", name: context.AuthInfo}
+	}
+	if len(opts.keepAuth) > 0 {
+		var err error
+		if auth, err = keepAuthMethod(auth, opts.keepAuth); err != nil {
+			return nil, fmt.Errorf("context %q: %w", contextName, err)
+		}
+	}
+	if opts.freezeExecEnv {
+		var frozen []string
+		if auth, frozen = freezeExecEnv(auth); len(frozen) > 0 {
+			logger.Printf("warning: embedding the values of %s from the current environment into the exec config of authinfo %q, they may be specific to this machine", strings.Join(frozen, ", "), context.AuthInfo)
+		}
+	}
+	outCfg.AuthInfos[context.AuthInfo] = auth
+
+	if relative := relativeFileRefs(server, auth); len(relative) > 0 {
+		logger.Printf("warning: context %q references %s by relative path, which will be resolved against the exploded file's directory", contextName, strings.Join(relative, ", "))
+	}
+
+	outCfg.CurrentContext = contextName
+	outCfg.Extensions = inCfg.Extensions
+	outCfg.Preferences = inCfg.Preferences
+
+	if opts.trimExtensions {
+		trimUnusedExtensions(outCfg, opts.extensionRefKeys)
+	}
+
+	if opts.onlyClusters || opts.onlyUsers {
+		outCfg.Contexts = map[string]*clientcmdapi.Context{}
+		outCfg.CurrentContext = ""
+	}
+	if opts.onlyClusters {
+		outCfg.AuthInfos = map[string]*clientcmdapi.AuthInfo{}
+	}
+	if opts.onlyUsers {
+		outCfg.Clusters = map[string]*clientcmdapi.Cluster{}
+	}
+
+	return outCfg, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultExtensionRefKeys are the extension fields --trim-unused-extensions
+// treats as references to context, cluster or authinfo names.
+var defaultExtensionRefKeys = []string{"context", "cluster", "user"}
+
+// trimUnusedExtensions drops top-level extensions of cfg whose refKeys fields
+// name a context, cluster or authinfo that is not part of cfg. Extensions
+// attached to the retained context, cluster or authinfo are left alone.
+func trimUnusedExtensions(cfg *clientcmdapi.Config, refKeys []string) {
+	trimmed := make(map[string]runtime.Object, len(cfg.Extensions))
+	for name, ext := range cfg.Extensions {
+		if !extensionHasDanglingRef(cfg, ext, refKeys) {
+			trimmed[name] = ext
+		}
+	}
+	cfg.Extensions = trimmed
+}
+
+func extensionHasDanglingRef(cfg *clientcmdapi.Config, ext runtime.Object, refKeys []string) bool {
+	fields, ok := extensionFields(ext)
+	if !ok {
+		return false
+	}
+
+	for _, key := range refKeys {
+		for _, ref := range extensionRefs(fields[key]) {
+			_, isContext := cfg.Contexts[ref]
+			_, isCluster := cfg.Clusters[ref]
+			_, isAuthInfo := cfg.AuthInfos[ref]
+			if !isContext && !isCluster && !isAuthInfo {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// extensionFields decodes the top-level fields of an extension. Extensions
+// loaded from a kubeconfig are kept as raw JSON by clientcmd.
+func extensionFields(ext runtime.Object) (map[string]any, bool) {
+	unknown, ok := ext.(*runtime.Unknown)
+	if !ok {
+		return nil, false
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(unknown.Raw, &fields); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
+
+// extensionRefs returns the names referenced by an extension field holding a
+// string or a list of strings.
+func extensionRefs(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var refs []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				refs = append(refs, s)
+			}
+		}
+		return refs
+	}
+	return nil
+}
+
+// extensionString returns the string held by extension, which is either the
+// extension itself or its field named field.
+func extensionString(ext runtime.Object, field string) (string, bool) {
+	unknown, ok := ext.(*runtime.Unknown)
+	if !ok {
+		return "", false
+	}
+
+	var value string
+	if err := json.Unmarshal(unknown.Raw, &value); err == nil {
+		return value, true
+	}
+
+	fields, ok := extensionFields(ext)
+	if !ok {
+		return "", false
+	}
+	value, ok = fields[field].(string)
+	return value, ok
+}
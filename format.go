@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Formats of serialized configs accepted by --format.
+const (
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+// toJSON converts serialized YAML content into indented JSON.
+func toJSON(content []byte) ([]byte, error) {
+	data, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// writeAggregate writes the JSON configs collected by --aggregate as a single
+// object keyed by context name.
+func writeAggregate(w io.Writer, configs map[string]json.RawMessage) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(configs); err != nil {
+		return fmt.Errorf("unable to write --aggregate output: %w", err)
+	}
+	return nil
+}
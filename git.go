@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// gitCommit stages the files written by the run and commits them to
+// e.gitRepo, or only logs what would be committed with --dry-run.
+func (e *exploder) gitCommit() error {
+	var paths, contexts []string
+	for _, entry := range e.plan {
+		switch entry.Action {
+		case actionCreate, actionOverwrite, actionMerge:
+		default:
+			continue
+		}
+		if !slices.Contains(paths, entry.Path) {
+			paths = append(paths, entry.Path)
+		}
+		if !slices.Contains(contexts, entry.Context) {
+			contexts = append(contexts, entry.Context)
+		}
+	}
+
+	if len(paths) == 0 {
+		e.logger.Print("--git-commit: nothing was written, not committing")
+		return nil
+	}
+
+	repo := e.gitRepo
+	if e.opts.dryRun {
+		e.logger.Printf("--git-commit: would commit %d files to %q:", len(paths), repo)
+		for _, path := range paths {
+			e.logger.Printf("  %s", displayPath(e.opts, path))
+		}
+		return nil
+	}
+
+	if _, err := runGit(repo, append([]string{"add", "--"}, paths...)...); err != nil {
+		return err
+	}
+	// Limiting the commit to paths leaves anything the user already had
+	// staged out of it.
+	args := append([]string{"commit", "--quiet", "-m", gitCommitMessage(contexts), "--"}, paths...)
+	if _, err := runGit(repo, args...); err != nil {
+		return err
+	}
+
+	e.logger.Printf("committed %d files to %q", len(paths), repo)
+	return nil
+}
+
+// gitRepository returns the top level directory of the git repository all of
+// paths belong to. The files don't need to exist yet.
+func gitRepository(paths []string) (string, error) {
+	var repo string
+	for _, path := range paths {
+		dir, err := existingDir(filepath.Dir(path))
+		if err != nil {
+			return "", err
+		}
+
+		top, err := runGit(dir, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return "", fmt.Errorf("--git-commit requires %q to be inside a git repository: %w", path, err)
+		}
+		switch {
+		case len(repo) == 0:
+			repo = top
+		case repo != top:
+			return "", fmt.Errorf("--git-commit requires all files to be in the same git repository, got %q and %q", repo, top)
+		}
+	}
+	return repo, nil
+}
+
+// existingDir returns dir or its closest ancestor that exists.
+func existingDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no existing parent directory of %q", dir)
+		}
+		dir = parent
+	}
+}
+
+// gitCommitMessage returns the message of the commit created for the
+// exploded contexts.
+func gitCommitMessage(contexts []string) string {
+	var b strings.Builder
+	if len(contexts) == 1 {
+		fmt.Fprintf(&b, "Update exploded kubeconfig for context %s\n", contexts[0])
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "Update exploded kubeconfigs for %d contexts\n\n", len(contexts))
+	for _, context := range contexts {
+		fmt.Fprintf(&b, "- %s\n", context)
+	}
+	return b.String()
+}
+
+// runGit runs git with args in dir and returns its trimmed output.
+func runGit(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return "", fmt.Errorf("unable to run git: %w", err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// hookContextEnvVar names the environment variable holding the context name
+// when running a --post-write-hook.
+const hookContextEnvVar = "KUBECTL_EXPLODE_CONTEXT"
+
+// shellCommand returns a command running cmd through sh with args appended,
+// so users can pass anything from a plain program to a small pipeline.
+func shellCommand(cmd string, args ...string) *exec.Cmd {
+	return exec.Command("sh", append([]string{"-c", cmd + ` "$@"`, "sh"}, args...)...)
+}
+
+// runPostWriteHook runs the --post-write-hook for a file written for
+// contextName.
+func (e *exploder) runPostWriteHook(contextName, path string) error {
+	cmd := shellCommand(e.opts.postWriteHook, path)
+	cmd.Env = append(os.Environ(), hookContextEnvVar+"="+contextName)
+	cmd.Stdout = e.logger.Writer()
+	cmd.Stderr = e.logger.Writer()
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("post-write hook failed for %q: %w", path, err)
+	}
+	return nil
+}
+
+// transform pipes the serialized config for contextName through the
+// --transform command and returns its output, which must still be a valid
+// kubeconfig unless --no-validate is set.
+func (e *exploder) transform(contextName string, content []byte) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := shellCommand(e.opts.transform)
+	cmd.Env = append(os.Environ(), hookContextEnvVar+"="+contextName)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &out
+	cmd.Stderr = e.logger.Writer()
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("transform failed for context %q: %w", contextName, err)
+	}
+
+	if !e.opts.noValidate {
+		if _, err := clientcmd.Load(out.Bytes()); err != nil {
+			return nil, fmt.Errorf("transform output for context %q is not a valid kubeconfig: %w", contextName, err)
+		}
+	}
+
+	return out.Bytes(), nil
+}
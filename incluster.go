@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// inClusterNamespaceFile holds the namespace of the pod's service account.
+const inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// inClusterConfig synthesizes a kubeconfig with a single context named
+// contextName from the in-cluster service account environment. The CA and
+// token are embedded so the result is usable outside of the pod.
+func inClusterConfig(contextName string) (*clientcmdapi.Config, error) {
+	restCfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load in-cluster config: %w", err)
+	}
+
+	cluster := clientcmdapi.NewCluster()
+	cluster.Server = restCfg.Host
+	if len(restCfg.TLSClientConfig.CAFile) > 0 {
+		ca, err := os.ReadFile(restCfg.TLSClientConfig.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read in-cluster CA: %w", err)
+		}
+		cluster.CertificateAuthorityData = ca
+	}
+
+	auth := clientcmdapi.NewAuthInfo()
+	auth.Token = restCfg.BearerToken
+
+	context := clientcmdapi.NewContext()
+	context.Cluster = contextName
+	context.AuthInfo = contextName
+	if ns, err := os.ReadFile(inClusterNamespaceFile); err == nil {
+		context.Namespace = strings.TrimSpace(string(ns))
+	}
+
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters[contextName] = cluster
+	cfg.AuthInfos[contextName] = auth
+	cfg.Contexts[contextName] = context
+	cfg.CurrentContext = contextName
+
+	return cfg, nil
+}
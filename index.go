@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// indexSchemaVersion is bumped whenever the --index format changes in a way
+// consumers need to know about.
+const indexSchemaVersion = 1
+
+type index struct {
+	SchemaVersion int          `yaml:"schemaVersion"`
+	Contexts      []indexEntry `yaml:"contexts"`
+}
+
+type indexEntry struct {
+	Name      string `yaml:"name"`
+	File      string `yaml:"file"`
+	Server    string `yaml:"server,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// writeIndex writes the --index file describing outputs. Files are listed
+// relative to the directory of the index when they are below it.
+func writeIndex(path string, outputs []output) error {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	idx := index{SchemaVersion: indexSchemaVersion, Contexts: make([]indexEntry, 0, len(outputs))}
+	for _, out := range outputs {
+		entry := indexEntry{Name: out.context, File: out.path}
+		if rel, err := filepath.Rel(dir, out.path); err == nil && filepath.IsLocal(rel) {
+			entry.File = rel
+		}
+		if context := out.cfg.Contexts[out.context]; context != nil {
+			entry.Namespace = context.Namespace
+			if cluster := out.cfg.Clusters[context.Cluster]; cluster != nil {
+				entry.Server = cluster.Server
+			}
+		}
+		idx.Contexts = append(idx.Contexts, entry)
+	}
+
+	content, err := encodeYAML(idx)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, content, 0600)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// keychainService is the service exploded configs are stored under in the OS
+// secret store (Keychain on macOS, Secret Service on Linux, Credential
+// Manager on Windows).
+const keychainService = "kubectl-explode"
+
+// keychainKey returns the key an output is stored under with --keychain,
+// which is its context name so --from-keychain takes the same names the
+// configs were exploded with.
+func keychainKey(out output) string {
+	return out.context
+}
+
+func storeInKeychain(key string, content []byte) error {
+	if err := keyring.Set(keychainService, key, string(content)); err != nil {
+		return fmt.Errorf("unable to store %q in the keychain: %w", key, err)
+	}
+	return nil
+}
+
+// loadFromKeychain loads and merges the configs stored under keys. Like the
+// regular loading rules, the first definition of any name wins.
+func loadFromKeychain(keys []string) (*clientcmdapi.Config, error) {
+	merged := clientcmdapi.NewConfig()
+	for _, key := range keys {
+		content, err := keyring.Get(keychainService, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %q from the keychain: %w", key, err)
+		}
+
+		cfg, err := clientcmd.Load([]byte(content))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load %q from the keychain: %w", key, err)
+		}
+
+		mergeMissing(merged.Clusters, cfg.Clusters)
+		mergeMissing(merged.AuthInfos, cfg.AuthInfos)
+		mergeMissing(merged.Contexts, cfg.Contexts)
+		mergeMissing(merged.Extensions, cfg.Extensions)
+		if len(merged.CurrentContext) == 0 {
+			merged.CurrentContext = cfg.CurrentContext
+		}
+	}
+	return merged, nil
+}
+
+// mergeMissing copies entries of src whose keys are not in dst yet.
+func mergeMissing[M ~map[string]V, V any](dst, src M) {
+	for name, value := range src {
+		if _, ok := dst[name]; !ok {
+			dst[name] = value
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultLabelExtension is the context extension --selector reads labels from.
+const defaultLabelExtension = "labels"
+
+// contextLabels returns the labels stored in the extension of context, which
+// holds a map of label names to string values. Non-string values are ignored.
+func contextLabels(context *clientcmdapi.Context, extension string) labels.Set {
+	ext, ok := context.Extensions[extension]
+	if !ok {
+		return nil
+	}
+
+	fields, ok := extensionFields(ext)
+	if !ok {
+		return nil
+	}
+
+	set := make(labels.Set, len(fields))
+	for key, value := range fields {
+		if s, ok := value.(string); ok {
+			set[key] = s
+		}
+	}
+	return set
+}
+
+// parseSelector parses a --selector value such as "team=platform,env=prod".
+// Requirements are ANDed together.
+func parseSelector(selector string) (labels.Selector, error) {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --selector %q: %w", selector, err)
+	}
+	return s, nil
+}
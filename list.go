@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// listEntry is a context as printed by --list -o json.
+type listEntry struct {
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	User      string `json:"user"`
+	Namespace string `json:"namespace"`
+	Current   bool   `json:"current"`
+	Source    string `json:"source,omitempty"`
+}
+
+// listContexts prints the contexts of the loaded kubeconfig in the style of
+// kubectl config get-contexts.
+func listContexts(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	cfg, err := loadConfig(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	switch opts.output {
+	case outputText:
+	case outputJSON:
+		return printContextsJSON(stdout, &cfg, opts.provenance)
+	default:
+		return fmt.Errorf("invalid --output %q, must be %s or %s", opts.output, outputText, outputJSON)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "CURRENT\tNAME\tCLUSTER\tAUTHINFO\tNAMESPACE")
+	if opts.provenance {
+		fmt.Fprint(tw, "\tSOURCE")
+	}
+	fmt.Fprintln(tw)
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Contexts)) {
+		context := cfg.Contexts[name]
+
+		current := ""
+		if name == cfg.CurrentContext {
+			current = "*"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s", current, name, context.Cluster, context.AuthInfo, context.Namespace)
+		if opts.provenance {
+			fmt.Fprintf(tw, "\t%s", context.LocationOfOrigin)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// printContextsJSON writes the contexts of cfg to w as a JSON array sorted by
+// name.
+func printContextsJSON(w io.Writer, cfg *clientcmdapi.Config, provenance bool) error {
+	entries := make([]listEntry, 0, len(cfg.Contexts))
+	for _, name := range slices.Sorted(maps.Keys(cfg.Contexts)) {
+		context := cfg.Contexts[name]
+		entry := listEntry{
+			Name:      name,
+			Cluster:   context.Cluster,
+			User:      context.AuthInfo,
+			Namespace: context.Namespace,
+			Current:   name == cfg.CurrentContext,
+		}
+		if provenance {
+			entry.Source = context.LocationOfOrigin
+		}
+		entries = append(entries, entry)
+	}
+
+	return printJSON(w, entries)
+}
+
+// clusterEntry is a cluster as printed by --list-clusters -o json.
+type clusterEntry struct {
+	Name       string `json:"name"`
+	Server     string `json:"server"`
+	Referenced bool   `json:"referenced"`
+}
+
+// listClusters prints every cluster of the loaded kubeconfig with its server,
+// marking the ones no context references.
+func listClusters(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	cfg, err := loadConfig(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	orphans, _ := findOrphans(&cfg)
+	entries := make([]clusterEntry, 0, len(cfg.Clusters))
+	for _, name := range slices.Sorted(maps.Keys(cfg.Clusters)) {
+		entries = append(entries, clusterEntry{
+			Name:       name,
+			Server:     cfg.Clusters[name].Server,
+			Referenced: !slices.Contains(orphans, name),
+		})
+	}
+
+	switch opts.output {
+	case outputText:
+	case outputJSON:
+		return printJSON(stdout, entries)
+	default:
+		return fmt.Errorf("invalid --output %q, must be %s or %s", opts.output, outputText, outputJSON)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSERVER\tREFERENCED")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Name, entry.Server, yesNo(entry.Referenced))
+	}
+	return tw.Flush()
+}
+
+// userEntry is an authinfo as printed by --list-users -o json.
+type userEntry struct {
+	Name       string   `json:"name"`
+	Auth       []string `json:"auth"`
+	Referenced bool     `json:"referenced"`
+}
+
+// listUsers prints every authinfo of the loaded kubeconfig with the auth
+// methods it has credentials for, marking the ones no context references.
+func listUsers(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	cfg, err := loadConfig(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	_, orphans := findOrphans(&cfg)
+	entries := make([]userEntry, 0, len(cfg.AuthInfos))
+	for _, name := range slices.Sorted(maps.Keys(cfg.AuthInfos)) {
+		entries = append(entries, userEntry{
+			Name:       name,
+			Auth:       authInfoMethods(cfg.AuthInfos[name]),
+			Referenced: !slices.Contains(orphans, name),
+		})
+	}
+
+	switch opts.output {
+	case outputText:
+	case outputJSON:
+		return printJSON(stdout, entries)
+	default:
+		return fmt.Errorf("invalid --output %q, must be %s or %s", opts.output, outputText, outputJSON)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tAUTH\tREFERENCED")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Name, strings.Join(entry.Auth, ","), yesNo(entry.Referenced))
+	}
+	return tw.Flush()
+}
+
+// printJSON writes v to w as indented JSON.
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
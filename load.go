@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeconfigDirExtensions are the file extensions considered when loading a
+// --kubeconfig-dir.
+var kubeconfigDirExtensions = []string{".yaml", ".yml", ".conf"}
+
+// Source formats accepted by --input-format. clientcmd decodes JSON as the
+// YAML subset it is, so auto and yaml parse sources the same way.
+const (
+	inputAuto = "auto"
+	inputYAML = "yaml"
+	inputJSON = "json"
+)
+
+// loadConfig loads and merges the source kubeconfig selected by opts.
+func loadConfig(opts *options, logger *log.Logger) (clientcmdapi.Config, error) {
+	if opts.inputFormat != inputAuto && opts.inputFormat != inputYAML && opts.inputFormat != inputJSON {
+		return clientcmdapi.Config{}, fmt.Errorf("invalid --input-format %q, must be %s, %s or %s", opts.inputFormat, inputAuto, inputYAML, inputJSON)
+	}
+
+	if len(opts.fromKeychain) > 0 {
+		if opts.inCluster || len(opts.kubeconfig) > 0 || len(opts.kubeconfigDir) > 0 || len(opts.kubeconfigData) > 0 {
+			return clientcmdapi.Config{}, errors.New("--from-keychain cannot be used with --in-cluster, --kubeconfig, --kubeconfig-dir or --kubeconfig-data")
+		}
+
+		cfg, err := loadFromKeychain(opts.fromKeychain)
+		if err != nil {
+			return clientcmdapi.Config{}, err
+		}
+		return *cfg, nil
+	}
+
+	if len(opts.kubeconfigData) > 0 {
+		if opts.inCluster || len(opts.kubeconfig) > 0 || len(opts.kubeconfigDir) > 0 {
+			return clientcmdapi.Config{}, errors.New("--kubeconfig-data cannot be used with --in-cluster, --kubeconfig or --kubeconfig-dir")
+		}
+		if err := checkInputData(opts.inputFormat, "--kubeconfig-data", []byte(opts.kubeconfigData)); err != nil {
+			return clientcmdapi.Config{}, err
+		}
+
+		cfg, err := clientcmd.Load([]byte(opts.kubeconfigData))
+		if err != nil {
+			return clientcmdapi.Config{}, fmt.Errorf("unable to load --kubeconfig-data: %w", err)
+		}
+		return *cfg, nil
+	}
+
+	if opts.inCluster {
+		if len(opts.kubeconfig) > 0 || len(opts.kubeconfigDir) > 0 {
+			return clientcmdapi.Config{}, errors.New("--in-cluster cannot be used with --kubeconfig or --kubeconfig-dir")
+		}
+
+		cfg, err := inClusterConfig(opts.inClusterName)
+		if err != nil {
+			return clientcmdapi.Config{}, err
+		}
+		return *cfg, nil
+	}
+
+	if isRemoteKubeconfig(opts.kubeconfig) {
+		if len(opts.kubeconfigDir) > 0 {
+			return clientcmdapi.Config{}, errors.New("--kubeconfig and --kubeconfig-dir are mutually exclusive")
+		}
+
+		cfg, err := loadRemoteKubeconfig(opts.kubeconfig, opts.inputFormat)
+		if err != nil {
+			return clientcmdapi.Config{}, err
+		}
+		return *cfg, nil
+	}
+
+	loadingRules, err := newLoadingRules(opts, logger)
+	if err != nil {
+		return clientcmdapi.Config{}, err
+	}
+
+	if len(opts.decryptAge) > 0 {
+		identities, err := parseAgeIdentities(opts.decryptAge)
+		if err != nil {
+			return clientcmdapi.Config{}, err
+		}
+		cfg, err := loadDecrypted(loadingRules.GetLoadingPrecedence(), identities)
+		if err != nil {
+			return clientcmdapi.Config{}, err
+		}
+		return *cfg, nil
+	}
+
+	if err := checkInputFormat(opts.inputFormat, loadingRules.GetLoadingPrecedence()); err != nil {
+		return clientcmdapi.Config{}, err
+	}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, nil).RawConfig()
+}
+
+func newLoadingRules(opts *options, logger *log.Logger) (*clientcmd.ClientConfigLoadingRules, error) {
+	if len(opts.kubeconfig) > 0 && len(opts.kubeconfigDir) > 0 {
+		return nil, errors.New("--kubeconfig and --kubeconfig-dir are mutually exclusive")
+	}
+
+	if isRemoteKubeconfig(opts.kubeconfig) {
+		return nil, fmt.Errorf("--kubeconfig %q is remote and can only be read from", opts.kubeconfig)
+	}
+	if len(opts.kubeconfigData) > 0 {
+		return nil, errors.New("--kubeconfig-data is not a file and can only be read from")
+	}
+
+	if len(opts.kubeconfig) > 0 {
+		if info, err := os.Stat(opts.kubeconfig); err == nil && info.IsDir() {
+			return nil, fmt.Errorf("--kubeconfig %q is a directory, pass a kubeconfig file or use --kubeconfig-dir to load every file in it", opts.kubeconfig)
+		}
+		return &clientcmd.ClientConfigLoadingRules{ExplicitPath: opts.kubeconfig}, nil
+	}
+
+	if len(opts.kubeconfigDir) > 0 {
+		files, err := kubeconfigDirFiles(opts.kubeconfigDir, len(opts.decryptAge) > 0, logger)
+		if err != nil {
+			return nil, err
+		}
+		return &clientcmd.ClientConfigLoadingRules{Precedence: files}, nil
+	}
+
+	return clientcmd.NewDefaultClientConfigLoadingRules(), nil
+}
+
+// kubeconfigDirFiles returns the kubeconfig files found directly inside dir,
+// sorted by name. Files that fail to parse as a kubeconfig are skipped. With
+// encrypted, files with the age suffix are included as well and left for
+// loadDecrypted to check.
+func kubeconfigDirFiles(dir string, encrypted bool, logger *log.Logger) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read kubeconfig directory %q: %w", dir, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if encrypted && filepath.Ext(entry.Name()) == ageSuffix {
+			files = append(files, path)
+			continue
+		}
+		if !slices.Contains(kubeconfigDirExtensions, filepath.Ext(entry.Name())) {
+			continue
+		}
+
+		if _, err := clientcmd.LoadFromFile(path); err != nil {
+			logger.Printf("skipping %q: %v", path, err)
+			continue
+		}
+
+		files = append(files, path)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no kubeconfig files found in %q", dir)
+	}
+
+	return files, nil
+}
+
+// checkInputFormat fails if any existing file in paths is not written in the
+// --input-format format, before clientcmd gets to parse it more leniently.
+func checkInputFormat(format string, paths []string) error {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read %q: %w", path, err)
+		}
+		if err := checkInputData(format, path, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkInputData fails if data, read from name, is not written in the
+// --input-format format.
+func checkInputData(format, name string, data []byte) error {
+	if format != inputJSON {
+		return nil
+	}
+
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("%q is not valid JSON as required by --input-format %s: %w", name, format, err)
+	}
+	return nil
+}
@@ -1,137 +1,259 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"maps"
 	"os"
-	"path/filepath"
-	"slices"
-	"strings"
 
 	flag "github.com/spf13/pflag"
-	"k8s.io/client-go/tools/clientcmd"
-	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
-var (
-	kubeconfig  string
-	allContexts bool
-	stdout      bool
-	force       bool
-)
-
-func init() {
-	flag.BoolVar(&allContexts, "all", false, "explode all contexts into separate files")
-	flag.BoolVar(&stdout, "stdout", false, "write exploded contexts to stdout instead of files")
-	flag.BoolVarP(&force, "force", "f", false, "force overwriting of destination files. Ignored when --stdout is used")
+type options struct {
+	kubeconfig              string
+	kubeconfigDir           string
+	kubeconfigData          string
+	inputFormat             string
+	decryptAge              string
+	inCluster               bool
+	inClusterName           string
+	fromKeychain            []string
+	authFrom                string
+	allContexts             bool
+	selector                string
+	labelExtension          string
+	annotate                []string
+	annotationExtension     string
+	usedSince               string
+	lastUsedExtension       string
+	includeMissingTimestamp bool
+	stdout                  bool
+	keychain                bool
+	single                  bool
+	base64                  bool
+	tee                     string
+	render                  string
+	renderOut               string
+	stdoutHeader            string
+	stdoutFooter            string
+	onlyClusters            bool
+	onlyUsers               bool
+	keepAuth                string
+	requireNamespace        bool
+	defaultNamespace        string
+	freezeExecEnv           bool
+	trimExtensions          bool
+	extensionRefKeys        []string
+	canonical               bool
+	passthroughSingle       bool
+	format                  string
+	aggregate               bool
+	transform               string
+	yamlDocumentStart       bool
+	encryptAge              []string
+	headerComment           string
+	headerFile              string
+	noFinalNewline          bool
+	noValidate              bool
+	asSecret                bool
+	secretNamespace         string
+	force                   bool
+	replace                 bool
+	noClobberDifferent      bool
+	allowOverwriteSource    bool
+	failOnOverwrite         bool
+	maxFileSize             string
+	writeRetries            int
+	mode                    string
+	modeExtension           string
+	showDiffOnSkip          bool
+	baseline                string
+	mergeInto               string
+	onConflict              string
+	stripPrefixes           []string
+	replaceChar             string
+	relativeTo              string
+	nameFrom                string
+	lowercase               bool
+	perNamespace            []string
+	postWriteHook           string
+	gitCommit               bool
+	ignoreHookErrors        bool
+	activate                bool
+	emitKubeconfigEnv       bool
+	index                   string
+	emitSwitcher            string
+	reuseKeys               bool
+	strictTLS               bool
+	normalizeServer         bool
+	renameKeys              bool
+	printToken              bool
+	validate                bool
+	reportOrphans           bool
+	pruneOrphans            bool
+	auditPerms              bool
+	fixPerms                bool
+	list                    bool
+	provenance              bool
+	listClusters            bool
+	listUsers               bool
+	watch                   bool
+	skipUnchanged           bool
+	limit                   int
+	dedupeIdentical         bool
+	concurrency             int
+	explain                 bool
+	preflight               bool
+	confirm                 bool
+	dryRun                  bool
+	output                  string
 }
 
 func main() {
-	flag.Parse()
-	args := flag.Args()
-
-	if !allContexts && len(args) == 0 {
-		log.Fatal("must specify context names or --all")
-	}
-
-	var loadingRules *clientcmd.ClientConfigLoadingRules
-	if len(kubeconfig) > 0 {
-		loadingRules = &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig}
-	}
-	if loadingRules == nil {
-		loadingRules = clientcmd.NewDefaultClientConfigLoadingRules()
-	}
-
-	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, nil).RawConfig()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if len(cfg.Contexts) == 0 {
-		log.Fatal("no contexts found")
-	}
-
-	contexts := make(map[string]bool)
-	for ctx := range cfg.Contexts {
-		contexts[ctx] = true
-	}
-	todo := make([]string, 0, len(args))
-
-	// Ensure that all specified contexts are present before writing out any files
-	if !allContexts {
-		for _, contextName := range args {
-			if _, ok := contexts[contextName]; !ok {
-				log.Fatal(fmt.Errorf("could not find context %q", contextName))
-			}
-
-			todo = append(todo, contextName)
-		}
-	} else {
-		todo = slices.Collect(maps.Keys(cfg.Contexts))
-	}
-
-	for _, contextName := range todo {
-		cfg, err := explodeContext(&cfg, contextName)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if stdout {
-			content, err := clientcmd.Write(*cfg)
-			if err != nil {
-				log.Fatal(err)
-			}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-			if _, err := io.Copy(os.Stdout, bytes.NewReader(content)); err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			path := filepath.Join(clientcmd.RecommendedConfigDir, strings.ReplaceAll(contextName, "/", "_"))
+// run is the entrypoint of the command. It parses args, writes any output to
+// stdout and diagnostics to stderr, and returns the process exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	logger := log.New(stderr, "", log.LstdFlags)
 
-			if _, err = os.Stat(path); err == nil {
-				if !force {
-					log.Printf("file %q already exists, use --force to overwrite", path)
-					continue
-				}
-			} else if !os.IsNotExist(err) {
-				log.Fatal(fmt.Errorf("unable to stat file %q: %w", path, err))
-			}
+	var opts options
+	flags := flag.NewFlagSet("kubectl-explode", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "path to the kubeconfig file to explode, or scp://[user@]host:/path to fetch it over SSH")
+	flags.StringVar(&opts.kubeconfigDir, "kubeconfig-dir", "", "load and merge every kubeconfig file in this directory")
+	flags.StringVar(&opts.kubeconfigData, "kubeconfig-data", "", "kubeconfig content to explode, instead of loading it from a file")
+	flags.StringVar(&opts.inputFormat, "input-format", inputAuto, "format of the source kubeconfig files: auto, yaml or json. json rejects sources that aren't valid JSON")
+	flags.StringVar(&opts.decryptAge, "decrypt-age", "", "age identity file used to decrypt encrypted source kubeconfigs. Includes "+ageSuffix+" files with --kubeconfig-dir")
+	flags.BoolVar(&opts.inCluster, "in-cluster", false, "explode a kubeconfig synthesized from the in-cluster service account")
+	flags.StringVar(&opts.inClusterName, "in-cluster-name", "in-cluster", "context, cluster and authinfo name used with --in-cluster")
+	flags.StringSliceVar(&opts.fromKeychain, "from-keychain", nil, "load the source from configs previously stored in the OS keychain with --keychain, by context name")
+	flags.StringVar(&opts.authFrom, "auth-from", "", "kubeconfig to look up authinfos in when they are missing from the source")
+	flags.BoolVar(&opts.allContexts, "all", false, "explode all contexts into separate files")
+	flags.StringVarP(&opts.selector, "selector", "l", "", "only explode contexts whose labels match this selector, e.g. team=platform,env=prod. Selects from all contexts when none are named")
+	flags.StringVar(&opts.labelExtension, "label-extension", defaultLabelExtension, "context extension holding the labels matched by --selector")
+	flags.StringVar(&opts.usedSince, "used-since", "", "only explode contexts whose last-used timestamp is within this duration, e.g. 30d or 12h")
+	flags.StringVar(&opts.lastUsedExtension, "last-used-extension", defaultLastUsedExtension, "context extension holding the RFC 3339 timestamp checked by --used-since")
+	flags.BoolVar(&opts.includeMissingTimestamp, "include-missing-timestamp", false, "with --used-since, keep contexts that have no last-used timestamp")
+	flags.BoolVar(&opts.stdout, "stdout", false, "write exploded contexts to stdout instead of files")
+	flags.BoolVar(&opts.keychain, "keychain", false, "store exploded contexts in the OS keychain instead of writing files, keyed by their context name")
+	flags.BoolVar(&opts.single, "single", false, "with --stdout, fail unless exactly one context is selected so the output is a single YAML document")
+	flags.BoolVar(&opts.base64, "base64", false, "with --stdout, print each context on a single line as its name followed by the base64 encoded config")
+	flags.StringVar(&opts.tee, "tee", "", "with --stdout, also write each context to a file in this directory")
+	flags.StringVar(&opts.render, "render", "", "Go template file rendered per context in place of its kubeconfig, with .Name, .Cluster, .Server, .User, .Namespace and .Kubeconfig")
+	flags.StringVar(&opts.renderOut, "render-out", "", "directory --render writes each rendered context to")
+	flags.StringVar(&opts.stdoutHeader, "stdout-header", "", "Go template printed before each context with --stdout, e.g. '# {{.Context}}'")
+	flags.StringVar(&opts.stdoutFooter, "stdout-footer", "", "Go template printed after each context with --stdout")
+	flags.BoolVar(&opts.onlyClusters, "only-clusters", false, "only export the clusters referenced by the selected contexts")
+	flags.BoolVar(&opts.onlyUsers, "only-users", false, "only export the authinfos referenced by the selected contexts")
+	flags.StringVar(&opts.keepAuth, "keep-auth", "", "only keep the credentials of this auth method in exploded authinfos: token, clientcert, exec or basic")
+	flags.StringVar(&opts.defaultNamespace, "default-namespace", "", "set this namespace on exploded contexts that don't have one. Satisfies --require-namespace")
+	flags.BoolVar(&opts.requireNamespace, "require-namespace", false, "fail if any selected context has no namespace set")
+	flags.BoolVar(&opts.freezeExecEnv, "freeze-exec-env", false, "embed the current values of environment variables referenced by exec configs as explicit env entries")
+	flags.BoolVar(&opts.trimExtensions, "trim-unused-extensions", false, "drop top-level extensions that reference contexts, clusters or authinfos not in the exploded config")
+	flags.StringArrayVar(&opts.annotate, "annotate", nil, "key=value pair stored in the --annotation-extension of every exploded file. May be repeated")
+	flags.StringVar(&opts.annotationExtension, "annotation-extension", defaultAnnotationExtension, "top-level extension --annotate stores its key/value pairs in")
+	flags.StringSliceVar(&opts.extensionRefKeys, "extension-ref-keys", defaultExtensionRefKeys, "extension fields that hold context, cluster or authinfo names for --trim-unused-extensions")
+	flags.StringVar(&opts.format, "format", formatYAML, "format of exploded configs: yaml or json")
+	flags.BoolVar(&opts.aggregate, "aggregate", false, "with --stdout and --format json, print a single JSON object mapping each context name to its config")
+	flags.BoolVar(&opts.passthroughSingle, "passthrough-single", false, "copy a source kubeconfig holding only the selected context byte for byte, keeping its comments and formatting")
+	flags.BoolVar(&opts.canonical, "canonical", false, "normalize serialized output so it is stable across library versions")
+	flags.StringVar(&opts.headerComment, "header", "", "comment prepended to every exploded config, each line prefixed with # unless it already is a comment")
+	flags.StringVar(&opts.headerFile, "header-file", "", "read the --header comment from this file")
+	flags.StringSliceVar(&opts.encryptAge, "encrypt-age", nil, "encrypt exploded files to these age recipients and write them with a "+ageSuffix+" suffix")
+	flags.BoolVar(&opts.yamlDocumentStart, "yaml-document-start", false, "start serialized configs with a --- document marker")
+	flags.BoolVar(&opts.noFinalNewline, "no-final-newline", false, "strip trailing newlines from serialized configs")
+	flags.StringVar(&opts.transform, "transform", "", "shell command each serialized config is piped through before it is written")
+	flags.BoolVar(&opts.noValidate, "no-validate", false, "don't check that --transform output is still a valid kubeconfig")
+	flags.BoolVar(&opts.asSecret, "as-secret", false, "wrap each exploded config in a Secret manifest under the kubeconfig data key")
+	flags.StringVar(&opts.secretNamespace, "secret-namespace", "", "namespace of the Secret manifests written with --as-secret")
+	flags.BoolVarP(&opts.force, "force", "f", false, "force overwriting of destination files. Ignored when --stdout is used")
+	flags.BoolVar(&opts.replace, "replace-existing", false, "remove existing destination files before writing them. Implies --force")
+	flags.BoolVar(&opts.noClobberDifferent, "no-clobber-different", false, "fail instead of skipping when a destination file exists with different content")
+	flags.BoolVar(&opts.showDiffOnSkip, "show-diff-on-skip", false, "for every existing file that is skipped, show whether and how it differs from what would be written")
+	flags.StringVar(&opts.mode, "mode", "0600", "octal file mode of exploded files")
+	flags.StringVar(&opts.modeExtension, "mode-extension", defaultModeExtension, "context extension holding a file mode that overrides --mode for that context")
+	flags.IntVar(&opts.writeRetries, "write-retries", 2, "retry writes failing with transient errors this many times with exponential backoff")
+	flags.BoolVar(&opts.failOnOverwrite, "fail-on-overwrite", false, "fail instead of skipping when a destination file already exists, whatever its content")
+	flags.BoolVar(&opts.allowOverwriteSource, "allow-overwrite-source", false, "allow exploded files to be written over the kubeconfig files they were loaded from")
+	flags.StringVar(&opts.maxFileSize, "max-file-size", "", "refuse to write exploded files larger than this size, e.g. 512Ki or 1Mi")
+	flags.StringVar(&opts.baseline, "baseline", "", "only explode contexts that are new or changed relative to this kubeconfig")
+	flags.StringVar(&opts.mergeInto, "merge-into", "", "merge exploded contexts into an existing kubeconfig file instead of writing separate files")
+	flags.StringVar(&opts.onConflict, "on-conflict", conflictError, "how to resolve existing keys when using --merge-into: error, skip, overwrite or rename")
+	flags.StringArrayVar(&opts.stripPrefixes, "strip-prefix", nil, "strip a leading prefix from context names when deriving filenames. May be repeated, the first matching prefix is stripped")
+	flags.StringVar(&opts.replaceChar, "replace-char", defaultSanitizer.replaceChar, "string replacing slashes in names when deriving filenames")
+	flags.StringVar(&opts.nameFrom, "name-from", nameFromContext, "context field exploded files are named after: context, cluster, user or namespace")
+	flags.StringVar(&opts.relativeTo, "relative-to", "", "show destination paths in logs and reports relative to this directory. Doesn't change where files are written")
+	flags.BoolVar(&opts.lowercase, "lowercase", false, "lowercase names when deriving filenames")
+	flags.StringSliceVar(&opts.perNamespace, "per-namespace", nil, "write one file per namespace for a single context, each with the namespace set and suffixed to the filename")
+	flags.StringVar(&opts.postWriteHook, "post-write-hook", "", "shell command run for every written file with its path as argument and the context name in $"+hookContextEnvVar)
+	flags.BoolVar(&opts.ignoreHookErrors, "ignore-hook-errors", false, "don't fail the run when a --post-write-hook fails")
+	flags.BoolVar(&opts.activate, "activate", false, "print the command that adds the exploded file to KUBECONFIG and makes it current. Requires a single context")
+	flags.BoolVar(&opts.emitKubeconfigEnv, "emit-kubeconfig-env", false, "print a shell-quoted KUBECONFIG value covering every exploded file, including existing ones that were skipped")
+	flags.StringVar(&opts.index, "index", "", "write a YAML index listing the file, server and namespace of every exploded context to this path")
+	flags.BoolVar(&opts.gitCommit, "git-commit", false, "stage the written files and commit them to the git repository they are in, listing the exploded contexts in the message")
+	flags.StringVar(&opts.emitSwitcher, "emit-switcher", "", "write a bash and zsh file defining a "+switcherFunction+" function that switches KUBECONFIG between the exploded contexts")
+	flags.BoolVar(&opts.reuseKeys, "reuse-keys", false, "with --all, write certificate data of shared clusters and authinfos to dedicated files referenced by path")
+	flags.BoolVar(&opts.normalizeServer, "normalize-server", false, "lowercase the scheme and host of cluster servers and trim trailing slashes")
+	flags.BoolVar(&opts.strictTLS, "strict-tls", false, "fail instead of warning when a context's cluster uses insecure-skip-tls-verify")
+	flags.BoolVar(&opts.renameKeys, "keys", false, "with rename, also rename the context's cluster and authinfo to the new name")
+	flags.BoolVar(&opts.validate, "validate", false, "check the loaded kubeconfig for dangling references, missing servers and credentials, orphans and insecure settings instead of exploding it")
+	flags.BoolVar(&opts.printToken, "print-token", false, "print the bearer token of a single context's authinfo instead of exploding it, running exec plugins if needed")
+	flags.BoolVar(&opts.reportOrphans, "report-orphans", false, "list clusters and authinfos in the source that no context references")
+	flags.BoolVar(&opts.pruneOrphans, "prune-orphans", false, "with --report-orphans, remove them from the source files")
+	flags.BoolVar(&opts.auditPerms, "audit-perms", false, "report files in the output directory with permissions broader than 0600")
+	flags.BoolVar(&opts.fixPerms, "fix-perms", false, "with --audit-perms, restrict offending files to owner-only permissions")
+	flags.BoolVar(&opts.list, "list", false, "list the contexts in the loaded kubeconfig instead of exploding them")
+	flags.BoolVar(&opts.listClusters, "list-clusters", false, "list the clusters in the loaded kubeconfig with their servers")
+	flags.BoolVar(&opts.listUsers, "list-users", false, "list the authinfos in the loaded kubeconfig with their auth methods")
+	flags.BoolVar(&opts.provenance, "provenance", false, "with --list, show the file each context was loaded from")
+	flags.BoolVar(&opts.watch, "watch", false, "keep running and re-explode whenever the source kubeconfig changes. Combine with --force to update existing files")
+	flags.BoolVar(&opts.dedupeIdentical, "dedupe-identical", false, "only explode the first of several contexts that resolve to identical context, cluster and authinfo definitions")
+	flags.IntVar(&opts.limit, "limit", 0, "only explode the first N selected contexts in sorted order. 0 means no limit")
+	flags.IntVar(&opts.concurrency, "concurrency", 1, "number of contexts serialized in parallel. Output is always written in selection order")
+	flags.BoolVar(&opts.explain, "explain", false, "print why each context was or wasn't selected")
+	flags.BoolVar(&opts.preflight, "preflight", false, "report which destinations are new, identical or conflicting before writing. Stops after the report with --dry-run")
+	flags.BoolVar(&opts.confirm, "confirm", false, "summarize the files that will be written and ask for confirmation before writing them")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "print what would be done without writing anything")
+	flags.StringVarP(&opts.output, "output", "o", outputText, "format of the --dry-run plan, --preflight report and listings: text or json")
 
-			if err := clientcmd.WriteToFile(*cfg, path); err != nil {
-				log.Fatal(err)
-			}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
 		}
-
-	}
-}
-
-func explodeContext(inCfg *clientcmdapi.Config, contextName string) (*clientcmdapi.Config, error) {
-	context, ok := inCfg.Contexts[contextName]
-	if !ok || context == nil {
-		return nil, fmt.Errorf("cannot find context %q", contextName)
+		// pflag only reports parse errors itself with ExitOnError.
+		fmt.Fprintln(stderr, err)
+		return 2
 	}
 
-	outCfg := clientcmdapi.NewConfig()
-	outCfg.Contexts[contextName] = context
-
-	server, ok := inCfg.Clusters[context.Cluster]
-	if !ok {
-		return nil, fmt.Errorf("cannot find server %q", context.Cluster)
+	cmd, cmdArgs := explode, flags.Args()
+	switch {
+	case flags.Arg(0) == "rename":
+		cmd, cmdArgs = renameContext, cmdArgs[1:]
+	case opts.watch:
+		cmd = watch
+	case opts.list:
+		cmd = listContexts
+	case opts.listClusters:
+		cmd = listClusters
+	case opts.listUsers:
+		cmd = listUsers
+	case opts.validate:
+		cmd = validateConfig
+	case opts.printToken:
+		cmd = printToken
+	case opts.reportOrphans:
+		cmd = reportOrphans
+	case opts.auditPerms:
+		cmd = auditPerms
 	}
-	outCfg.Clusters[context.Cluster] = server
 
-	auth, ok := inCfg.AuthInfos[context.AuthInfo]
-	if !ok {
-		return nil, fmt.Errorf("cannot find authinfo %q", context.AuthInfo)
+	if err := cmd(&opts, cmdArgs, stdout, logger); err != nil {
+		logger.Print(err)
+		return 1
 	}
-	outCfg.AuthInfos[context.AuthInfo] = auth
-
-	outCfg.CurrentContext = contextName
-	outCfg.Extensions = inCfg.Extensions
-	outCfg.Preferences = inCfg.Preferences
 
-	return outCfg, nil
+	return 0
 }
@@ -0,0 +1,796 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: a
+clusters:
+- name: c1
+  cluster:
+    server: https://c1.example.com
+- name: c2
+  cluster:
+    server: https://c2.example.com
+users:
+- name: u1
+  user:
+    token: t1
+- name: u2
+  user:
+    token: t2
+contexts:
+- name: a
+  context:
+    cluster: c1
+    user: u1
+- name: b
+  context:
+    cluster: c2
+    user: u2
+    namespace: dev
+`
+
+// setupHome points HOME and the default kube config directory at a fresh
+// temporary directory and returns that kube directory, which doesn't exist
+// yet.
+func setupHome(t *testing.T) string {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("KUBECONFIG", "")
+
+	// clientcmd computes these from HOME once at init.
+	dir, file := clientcmd.RecommendedConfigDir, clientcmd.RecommendedHomeFile
+	t.Cleanup(func() {
+		clientcmd.RecommendedConfigDir, clientcmd.RecommendedHomeFile = dir, file
+	})
+	kubeDir := filepath.Join(home, ".kube")
+	clientcmd.RecommendedConfigDir = kubeDir
+	clientcmd.RecommendedHomeFile = filepath.Join(kubeDir, "config")
+
+	return kubeDir
+}
+
+// writeTestFile writes content to path, creating its directory.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runCommand runs the command line args and returns what it wrote to stdout
+// and stderr along with its exit code.
+func runCommand(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestExplodeToFiles(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testKubeconfig)
+
+	_, stderr, code := runCommand(t, "--kubeconfig", source, "--all")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		cfg, err := clientcmd.LoadFromFile(filepath.Join(kubeDir, name))
+		if err != nil {
+			t.Fatalf("loading exploded file %q: %v", name, err)
+		}
+		if cfg.CurrentContext != name {
+			t.Errorf("file %q has current-context %q", name, cfg.CurrentContext)
+		}
+		if len(cfg.Contexts) != 1 || len(cfg.Clusters) != 1 || len(cfg.AuthInfos) != 1 {
+			t.Errorf("file %q has %d contexts, %d clusters and %d authinfos, want 1 of each", name, len(cfg.Contexts), len(cfg.Clusters), len(cfg.AuthInfos))
+		}
+	}
+}
+
+func TestExplodeToStdout(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testKubeconfig)
+
+	stdout, stderr, code := runCommand(t, "--kubeconfig", source, "--stdout", "b")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	cfg, err := clientcmd.Load([]byte(stdout))
+	if err != nil {
+		t.Fatalf("stdout is not a kubeconfig: %v\n%s", err, stdout)
+	}
+	if _, ok := cfg.Contexts["b"]; !ok || len(cfg.Contexts) != 1 {
+		t.Errorf("stdout holds contexts %v, want only b", cfg.Contexts)
+	}
+	if _, err := os.Stat(kubeDir); !os.IsNotExist(err) {
+		t.Errorf("--stdout created %q", kubeDir)
+	}
+}
+
+func TestExplodeErrors(t *testing.T) {
+	setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testKubeconfig)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no contexts", []string{"--kubeconfig", source}, "must specify context names"},
+		{"missing context", []string{"--kubeconfig", source, "missing"}, `cannot find context "missing"`},
+		{"unknown flag", []string{"--no-such-flag"}, "unknown flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, code := runCommand(t, tt.args...)
+			if code == 0 {
+				t.Fatal("exit code 0, want failure")
+			}
+			if !strings.Contains(stderr, tt.want) {
+				t.Errorf("stderr %q does not contain %q", stderr, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectMissingContext(t *testing.T) {
+	cfg, err := clientcmd.Load([]byte(testKubeconfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &exploder{opts: &options{}}
+	if _, err := e.selectContexts(cfg, []string{"a", "missing"}); !errors.Is(err, ErrContextNotFound) {
+		t.Errorf("error %v is not ErrContextNotFound", err)
+	}
+}
+
+func TestMergeIntoRepeated(t *testing.T) {
+	for _, strategy := range []string{conflictError, conflictRename} {
+		t.Run(strategy, func(t *testing.T) {
+			setupHome(t)
+			dir := t.TempDir()
+			source, target := filepath.Join(dir, "source"), filepath.Join(dir, "target")
+			writeTestFile(t, source, testKubeconfig)
+
+			// Merging the same contexts again finds identical definitions,
+			// which must neither conflict nor be duplicated.
+			for i := 0; i < 2; i++ {
+				_, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--merge-into", target, "--on-conflict", strategy)
+				if code != 0 {
+					t.Fatalf("merge %d: exit code %d, stderr:\n%s", i+1, code, stderr)
+				}
+			}
+
+			cfg, err := clientcmd.LoadFromFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cfg.Contexts) != 2 || len(cfg.Clusters) != 2 || len(cfg.AuthInfos) != 2 {
+				t.Errorf("target has %d contexts, %d clusters and %d authinfos, want 2 of each", len(cfg.Contexts), len(cfg.Clusters), len(cfg.AuthInfos))
+			}
+		})
+	}
+}
+
+// testSharedKubeconfig has two contexts sharing a cluster with embedded CA
+// data.
+const testSharedKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: shared
+  cluster:
+    server: https://shared.example.com
+    certificate-authority-data: Y2EtZGF0YQ==
+users:
+- name: u1
+  user:
+    token: t1
+contexts:
+- name: a
+  context:
+    cluster: shared
+    user: u1
+- name: b
+  context:
+    cluster: shared
+    user: u1
+    namespace: dev
+`
+
+func TestReuseKeysPlansSharedFiles(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testSharedKubeconfig)
+	caFile := filepath.Join(kubeDir, "shared", "shared.ca.crt")
+
+	stdout, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--reuse-keys", "--dry-run")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+	if !strings.Contains(stdout, caFile) {
+		t.Errorf("--dry-run plan does not list %q:\n%s", caFile, stdout)
+	}
+	if _, err := os.Stat(caFile); !os.IsNotExist(err) {
+		t.Errorf("--dry-run wrote %q", caFile)
+	}
+
+	writeTestFile(t, caFile, "existing")
+
+	if _, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--reuse-keys", "--fail-on-overwrite"); code == 0 || !strings.Contains(stderr, "--fail-on-overwrite") {
+		t.Errorf("--fail-on-overwrite: exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	if _, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--reuse-keys"); code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+	if data, _ := os.ReadFile(caFile); string(data) != "existing" {
+		t.Errorf("%q was overwritten without --force: %q", caFile, data)
+	}
+
+	if _, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--reuse-keys", "--force"); code != 0 {
+		t.Fatalf("--force: exit code %d, stderr:\n%s", code, stderr)
+	}
+	if data, _ := os.ReadFile(caFile); string(data) != "ca-data" {
+		t.Errorf("%q holds %q after --force, want the CA data", caFile, data)
+	}
+}
+
+func TestActivateQuotesPath(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, strings.ReplaceAll(testKubeconfig, "name: a\n", "name: it's $(prod)\n"))
+
+	stdout, stderr, code := runCommand(t, "--kubeconfig", source, "--activate", "it's $(prod)")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	out, err := exec.Command("sh", "-c", stdout+`printf %s "$KUBECONFIG"`).Output()
+	if err != nil {
+		t.Fatalf("evaluating %q: %v", stdout, err)
+	}
+	want := filepath.Join(kubeDir, "it's $(prod)") + string(filepath.ListSeparator) + clientcmd.RecommendedHomeFile
+	if string(out) != want {
+		t.Errorf("KUBECONFIG is %q, want %q", out, want)
+	}
+}
+
+func TestAuditPermsSkipsKubectlCache(t *testing.T) {
+	kubeDir := setupHome(t)
+	cacheFile := filepath.Join(kubeDir, "cache", "discovery", "servergroups.json")
+	writeTestFile(t, cacheFile, "{}")
+	if err := os.Chmod(cacheFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(kubeDir, "a"), testKubeconfig)
+
+	if _, stderr, code := runCommand(t, "--audit-perms"); code != 0 {
+		t.Errorf("exit code %d for a kube dir with only kubectl's cache readable, stderr:\n%s", code, stderr)
+	}
+
+	broad := filepath.Join(kubeDir, "b")
+	writeTestFile(t, broad, testKubeconfig)
+	if err := os.Chmod(broad, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runCommand(t, "--audit-perms", "--fix-perms"); code != 0 {
+		t.Fatalf("--fix-perms: exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	for path, want := range map[string]os.FileMode{broad: 0600, cacheFile: 0644} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%q has mode %#o, want %#o", path, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestCollidingDestinations(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	cfg := strings.NewReplacer("name: a\n", "name: team/a\n", "name: b\n", "name: team_a\n").Replace(testKubeconfig)
+	writeTestFile(t, source, cfg)
+
+	_, stderr, code := runCommand(t, "--kubeconfig", source, "--all")
+	if code == 0 {
+		t.Fatal("exit code 0, want a collision error")
+	}
+	want := "would both be written to " + strconv.Quote(filepath.Join(kubeDir, "team_a"))
+	if !strings.Contains(stderr, want) {
+		t.Errorf("stderr %q does not contain %q", stderr, want)
+	}
+	if _, err := os.Stat(kubeDir); !os.IsNotExist(err) {
+		t.Errorf("files were written despite the collision")
+	}
+}
+
+func TestWriteThroughNamedPipeKeepsMode(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testKubeconfig)
+
+	if err := os.MkdirAll(kubeDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	pipe := filepath.Join(kubeDir, "a")
+	if err := exec.Command("mkfifo", pipe).Run(); err != nil {
+		t.Skipf("unable to create a named pipe: %v", err)
+	}
+	if err := os.Chmod(pipe, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read := make(chan []byte)
+	go func() {
+		data, _ := os.ReadFile(pipe)
+		read <- data
+	}()
+
+	if _, stderr, code := runCommand(t, "--kubeconfig", source, "a"); code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+	if _, err := clientcmd.Load(<-read); err != nil {
+		t.Errorf("read an invalid kubeconfig from the pipe: %v", err)
+	}
+
+	info, err := os.Stat(pipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("named pipe has mode %#o after the write, want 0644", info.Mode().Perm())
+	}
+}
+
+func TestSanitizeFilenames(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "source")
+	cfg := strings.NewReplacer("name: a\n", "name: team/Prod\n", "name: b\n", `name: DOMAIN\user`+"\n").Replace(testKubeconfig)
+	writeTestFile(t, source, cfg)
+
+	tests := []struct {
+		name  string
+		args  []string
+		files []string
+	}{
+		{"default", nil, []string{"team_Prod", `DOMAIN\user`}},
+		{"replace char and lowercase", []string{"--replace-char", "-", "--lowercase"}, []string{"team-prod", `domain\user`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeDir := setupHome(t)
+			args := append([]string{"--kubeconfig", source, "--all"}, tt.args...)
+			if _, stderr, code := runCommand(t, args...); code != 0 {
+				t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+			}
+			for _, file := range tt.files {
+				if _, err := os.Stat(filepath.Join(kubeDir, file)); err != nil {
+					t.Errorf("expected file %q: %v", file, err)
+				}
+			}
+		})
+	}
+
+	// sanitizeName is the default derivation the CLI uses.
+	for name, want := range map[string]string{"team/Prod": "team_Prod", `DOMAIN\user`: `DOMAIN\user`} {
+		if got := sanitizeName(name); got != want {
+			t.Errorf("sanitizeName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestKeychainRoundTripByContextName(t *testing.T) {
+	setupHome(t)
+	keyring.MockInit()
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, strings.ReplaceAll(testKubeconfig, "name: a\n", "name: team/prod\n"))
+
+	if _, stderr, code := runCommand(t, "--kubeconfig", source, "--keychain", "--strip-prefix", "team/", "team/prod"); code != 0 {
+		t.Fatalf("--keychain: exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	stdout, stderr, code := runCommand(t, "--from-keychain", "team/prod", "--stdout", "team/prod")
+	if code != 0 {
+		t.Fatalf("--from-keychain: exit code %d, stderr:\n%s", code, stderr)
+	}
+	cfg, err := clientcmd.Load([]byte(stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Contexts["team/prod"]; !ok {
+		t.Errorf("config loaded from the keychain lacks context team/prod: %v", cfg.Contexts)
+	}
+}
+
+func TestCreatesMissingKubeDir(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testKubeconfig)
+
+	if _, stderr, code := runCommand(t, "--kubeconfig", source, "a"); code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	info, err := os.Stat(kubeDir)
+	if err != nil {
+		t.Fatalf("default directory was not created: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("%q has mode %#o, want 0700", kubeDir, info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(kubeDir, "a")); err != nil {
+		t.Errorf("exploded file was not written: %v", err)
+	}
+}
+
+func TestConcurrentStdoutOrder(t *testing.T) {
+	setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nkind: Config\nclusters:\n- name: c\n  cluster:\n    server: https://c.example.com\nusers:\n- name: u\n  user:\n    token: t\ncontexts:\n")
+	for i := 0; i < 32; i++ {
+		fmt.Fprintf(&b, "- name: ctx-%02d\n  context:\n    cluster: c\n    user: u\n", i)
+	}
+	writeTestFile(t, source, b.String())
+
+	want, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--stdout", "--stdout-header", "# {{.Context}}\n")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	for i := 0; i < 10; i++ {
+		got, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--stdout", "--stdout-header", "# {{.Context}}\n", "--concurrency", "8")
+		if code != 0 {
+			t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+		}
+		if got != want {
+			t.Fatalf("run %d with --concurrency 8 wrote a different stdout than a sequential run", i+1)
+		}
+	}
+}
+
+func TestKubeconfigDirectoryRejected(t *testing.T) {
+	setupHome(t)
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config"), testKubeconfig)
+
+	_, stderr, code := runCommand(t, "--kubeconfig", dir, "--all")
+	if code == 0 {
+		t.Fatal("exit code 0, want failure for a directory --kubeconfig")
+	}
+	if !strings.Contains(stderr, "is a directory") || !strings.Contains(stderr, "--kubeconfig-dir") {
+		t.Errorf("stderr %q does not point at --kubeconfig-dir", stderr)
+	}
+}
+
+func TestReuseKeysWritesNothingWhenAborted(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testSharedKubeconfig)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		// Test stdin is not a terminal, so --confirm always aborts.
+		{"confirm", []string{"--confirm"}},
+		{"max file size", []string{"--max-file-size", "10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeDir := setupHome(t)
+			args := append([]string{"--kubeconfig", source, "--all", "--reuse-keys"}, tt.args...)
+			if _, _, code := runCommand(t, args...); code == 0 {
+				t.Fatal("exit code 0, want the run to be aborted")
+			}
+			if _, err := os.Stat(kubeDir); !os.IsNotExist(err) {
+				t.Errorf("an aborted run wrote into %q", kubeDir)
+			}
+		})
+	}
+}
+
+func TestRefusesToOverwriteSource(t *testing.T) {
+	t.Run("context named config", func(t *testing.T) {
+		kubeDir := setupHome(t)
+		source := filepath.Join(kubeDir, "config")
+		cfg := strings.ReplaceAll(testKubeconfig, "name: a\n", "name: config\n")
+		writeTestFile(t, source, cfg)
+
+		_, stderr, code := runCommand(t, "--force", "config")
+		if code == 0 || !strings.Contains(stderr, "would overwrite the source kubeconfig") {
+			t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+		}
+		if data, _ := os.ReadFile(source); string(data) != cfg {
+			t.Errorf("source kubeconfig was overwritten")
+		}
+
+		if _, stderr, code := runCommand(t, "--force", "--allow-overwrite-source", "config"); code != 0 {
+			t.Errorf("--allow-overwrite-source: exit code %d, stderr:\n%s", code, stderr)
+		}
+	})
+
+	t.Run("tee", func(t *testing.T) {
+		setupHome(t)
+		dir := t.TempDir()
+		source := filepath.Join(dir, "a")
+		writeTestFile(t, source, testKubeconfig)
+
+		_, stderr, code := runCommand(t, "--kubeconfig", source, "--stdout", "--tee", dir, "--force", "a")
+		if code == 0 || !strings.Contains(stderr, "would overwrite the source kubeconfig") {
+			t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+		}
+		if data, _ := os.ReadFile(source); string(data) != testKubeconfig {
+			t.Errorf("source kubeconfig was overwritten through --tee")
+		}
+	})
+}
+
+func TestPruneOrphansRequiresLocalSource(t *testing.T) {
+	kubeDir := setupHome(t)
+	keyring.MockInit()
+
+	// The keychain config has c2 and u2 as orphans, while ~/.kube/config
+	// still uses them.
+	local := filepath.Join(kubeDir, "config")
+	writeTestFile(t, local, testKubeconfig)
+	keychainCfg := strings.Replace(testKubeconfig, "- name: b\n  context:\n    cluster: c2\n    user: u2\n    namespace: dev\n", "", 1)
+	if err := keyring.Set(keychainService, "a", keychainCfg); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stderr, code := runCommand(t, "--from-keychain", "a", "--report-orphans", "--prune-orphans")
+	if code == 0 || !strings.Contains(stderr, "--prune-orphans requires a local") {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+	if data, _ := os.ReadFile(local); string(data) != testKubeconfig {
+		t.Errorf("~/.kube/config was modified:\n%s", data)
+	}
+
+	stdout, stderr, code := runCommand(t, "--from-keychain", "a", "--report-orphans")
+	if code != 0 {
+		t.Fatalf("--report-orphans: exit code %d, stderr:\n%s", code, stderr)
+	}
+	if want := "cluster\tc2\nauthinfo\tu2\n"; stdout != want {
+		t.Errorf("--report-orphans printed %q, want %q", stdout, want)
+	}
+}
+
+func TestPruneOrphansFromKubeconfig(t *testing.T) {
+	setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, strings.Replace(testKubeconfig, "- name: b\n  context:\n    cluster: c2\n    user: u2\n    namespace: dev\n", "", 1))
+
+	if _, stderr, code := runCommand(t, "--kubeconfig", source, "--report-orphans", "--prune-orphans"); code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	cfg, err := clientcmd.LoadFromFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Clusters["c2"]; ok {
+		t.Error("orphaned cluster c2 was not pruned")
+	}
+	if _, ok := cfg.AuthInfos["u2"]; ok {
+		t.Error("orphaned authinfo u2 was not pruned")
+	}
+	if _, ok := cfg.Contexts["a"]; !ok {
+		t.Error("context a was removed")
+	}
+}
+
+func TestRenameKeepsSymlinkAndMode(t *testing.T) {
+	kubeDir := setupHome(t)
+	target := filepath.Join(t.TempDir(), "dotfiles", "kubeconfig")
+	writeTestFile(t, target, testKubeconfig)
+	if err := os.Chmod(target, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(kubeDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(kubeDir, "config")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, stderr, code := runCommand(t, "rename", "a", "renamed"); code != 0 {
+		t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%s was replaced by a regular file", link)
+	}
+
+	info, err = os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0644 {
+		t.Errorf("mode of %s is %o, want 644", target, perm)
+	}
+
+	cfg, err := clientcmd.LoadFromFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Contexts["renamed"]; !ok {
+		t.Errorf("context a was not renamed in %s", target)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to read while a command writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestWatchOverwritesChangedFiles(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testKubeconfig)
+	exploded := filepath.Join(kubeDir, "a")
+
+	// An outdated file from an earlier run must be brought in sync as well.
+	writeTestFile(t, exploded, strings.ReplaceAll(testKubeconfig, "c1.example.com", "old.example.com"))
+
+	var stdout, stderr syncBuffer
+	done := make(chan int)
+	go func() { done <- run([]string{"--kubeconfig", source, "--watch", "a"}, &stdout, &stderr) }()
+
+	server := func() string {
+		cfg, err := clientcmd.LoadFromFile(exploded)
+		if err != nil || cfg.Clusters["c1"] == nil {
+			return ""
+		}
+		return cfg.Clusters["c1"].Server
+	}
+	waitFor(t, "the initial sync", func() bool { return strings.Contains(stderr.String(), "watching") })
+	if got := server(); got != "https://c1.example.com" {
+		t.Fatalf("initial sync left server %q", got)
+	}
+
+	writeTestFile(t, source, strings.ReplaceAll(testKubeconfig, "c1.example.com", "new.example.com"))
+	waitFor(t, "the changed server to be synced", func() bool { return server() == "https://new.example.com" })
+
+	// Rewriting the source with the same content changes no exploded file.
+	writeTestFile(t, source, strings.ReplaceAll(testKubeconfig, "c1.example.com", "new.example.com"))
+	waitFor(t, "an up to date sync", func() bool { return strings.Contains(stderr.String(), "already up to date") })
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("unable to interrupt the watch: %v", err)
+	}
+	if code := <-done; code != 0 {
+		t.Errorf("exit code %d, stderr:\n%s", code, stderr.String())
+	}
+	if n := strings.Count(stderr.String(), "synced 1 exploded files"); n != 2 {
+		t.Errorf("logged %d syncs of 1 file, want 2 (initial and changed), stderr:\n%s", n, stderr.String())
+	}
+}
+
+func TestDefaultNamespace(t *testing.T) {
+	// Context a has no namespace and b has dev.
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, testKubeconfig)
+
+	t.Run("require namespace fails without it", func(t *testing.T) {
+		setupHome(t)
+		_, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--require-namespace")
+		if code == 0 || !strings.Contains(stderr, "contexts without a namespace: a") {
+			t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+		}
+	})
+
+	for _, args := range [][]string{
+		{"--default-namespace", "fallback"},
+		{"--default-namespace", "fallback", "--require-namespace"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			kubeDir := setupHome(t)
+			if _, stderr, code := runCommand(t, append([]string{"--kubeconfig", source, "--all"}, args...)...); code != 0 {
+				t.Fatalf("exit code %d, stderr:\n%s", code, stderr)
+			}
+
+			for name, want := range map[string]string{"a": "fallback", "b": "dev"} {
+				cfg, err := clientcmd.LoadFromFile(filepath.Join(kubeDir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := cfg.Contexts[name].Namespace; got != want {
+					t.Errorf("context %q has namespace %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEmitKubeconfigEnv(t *testing.T) {
+	kubeDir := setupHome(t)
+	source := filepath.Join(t.TempDir(), "source")
+	writeTestFile(t, source, strings.ReplaceAll(testKubeconfig, "name: a\n", "name: my $(ctx)\n"))
+	want := filepath.Join(kubeDir, "b") + string(filepath.ListSeparator) + filepath.Join(kubeDir, "my $(ctx)")
+
+	// The second run skips both files as they exist, which must still list
+	// them rather than print an empty value.
+	for i := 0; i < 2; i++ {
+		stdout, stderr, code := runCommand(t, "--kubeconfig", source, "--all", "--emit-kubeconfig-env")
+		if code != 0 {
+			t.Fatalf("run %d: exit code %d, stderr:\n%s", i+1, code, stderr)
+		}
+
+		out, err := exec.Command("sh", "-c", "eval "+shellQuote(stdout)+` && printf %s "$KUBECONFIG"`).Output()
+		if err != nil {
+			t.Fatalf("run %d: evaluating %q: %v", i+1, stdout, err)
+		}
+		if string(out) != want {
+			t.Errorf("run %d: KUBECONFIG is %q, want %q", i+1, out, want)
+		}
+	}
+}
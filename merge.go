@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Conflict strategies for --merge-into. A conflict is an incoming cluster,
+// authinfo or context whose key already exists in the target with a different
+// definition; identical definitions are never considered conflicting.
+//
+//   - error:     abort the run without writing the target.
+//   - skip:      keep the target's definition and drop the incoming one. A
+//     skipped cluster or authinfo means the incoming context will reference
+//     the target's definition of that key.
+//   - overwrite: replace the target's definition with the incoming one.
+//   - rename:    add the incoming definition under a new key suffixed with
+//     "-N". Renamed clusters and authinfos are rewritten in the incoming
+//     context so it keeps referencing its own definitions.
+const (
+	conflictError     = "error"
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+var conflictStrategies = []string{conflictError, conflictSkip, conflictOverwrite, conflictRename}
+
+// loadMergeTarget loads the kubeconfig at path, returning an empty config if
+// the file does not exist yet.
+func loadMergeTarget(path string) (*clientcmdapi.Config, error) {
+	cfg, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		return clientcmdapi.NewConfig(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %q: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// mergeConfig merges the single context config src into dst, resolving key
+// conflicts according to strategy.
+func mergeConfig(dst, src *clientcmdapi.Config, strategy string, logger *log.Logger) error {
+	for contextName, context := range src.Contexts {
+		context = context.DeepCopy()
+
+		clusterName, err := mergeEntry(dst.Clusters, context.Cluster, src.Clusters[context.Cluster], sameCluster, "cluster", strategy, logger)
+		if err != nil {
+			return err
+		}
+		context.Cluster = clusterName
+
+		authName, err := mergeEntry(dst.AuthInfos, context.AuthInfo, src.AuthInfos[context.AuthInfo], sameAuthInfo, "authinfo", strategy, logger)
+		if err != nil {
+			return err
+		}
+		context.AuthInfo = authName
+
+		if _, err := mergeEntry(dst.Contexts, contextName, context, sameContext, "context", strategy, logger); err != nil {
+			return err
+		}
+	}
+
+	if len(dst.CurrentContext) == 0 {
+		dst.CurrentContext = src.CurrentContext
+	}
+
+	return nil
+}
+
+// mergeEntry adds value to m under name, returning the key it ended up
+// referenced by. Existing entries for which same returns true are identical
+// definitions and never conflict.
+func mergeEntry[T any](m map[string]T, name string, value T, same func(a, b T) bool, kind, strategy string, logger *log.Logger) (string, error) {
+	existing, ok := m[name]
+	if !ok || same(existing, value) {
+		m[name] = value
+		return name, nil
+	}
+
+	switch strategy {
+	case conflictSkip:
+		logger.Printf("%s %q already exists, skipping", kind, name)
+		return name, nil
+	case conflictOverwrite:
+		logger.Printf("%s %q already exists, overwriting", kind, name)
+		m[name] = value
+		return name, nil
+	case conflictRename:
+		for i := 1; ; i++ {
+			renamed := name + "-" + strconv.Itoa(i)
+			if existing, ok := m[renamed]; ok && same(existing, value) {
+				return renamed, nil
+			} else if !ok {
+				logger.Printf("%s %q already exists, adding as %q", kind, name, renamed)
+				m[renamed] = value
+				return renamed, nil
+			}
+		}
+	default:
+		return "", fmt.Errorf("%s %q already exists, use --on-conflict to resolve", kind, name)
+	}
+}
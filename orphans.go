@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// findOrphans returns the sorted names of clusters and authinfos in cfg that no
+// context references.
+func findOrphans(cfg *clientcmdapi.Config) (clusters, authInfos []string) {
+	usedClusters := make(map[string]bool)
+	usedAuthInfos := make(map[string]bool)
+	for _, context := range cfg.Contexts {
+		usedClusters[context.Cluster] = true
+		usedAuthInfos[context.AuthInfo] = true
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Clusters)) {
+		if !usedClusters[name] {
+			clusters = append(clusters, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.AuthInfos)) {
+		if !usedAuthInfos[name] {
+			authInfos = append(authInfos, name)
+		}
+	}
+
+	return clusters, authInfos
+}
+
+// reportOrphans prints the clusters and authinfos of the loaded config that
+// no context references, removing them from the source files with
+// --prune-orphans.
+func reportOrphans(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	// Pruning rewrites the files of the loading rules, which only hold the
+	// orphans found if they are where the config was loaded from.
+	if opts.pruneOrphans && (len(opts.fromKeychain) > 0 || opts.inCluster || len(opts.kubeconfigData) > 0 || isRemoteKubeconfig(opts.kubeconfig) || len(opts.decryptAge) > 0) {
+		return errors.New("--prune-orphans requires a local plain kubeconfig source and cannot be used with --from-keychain, --in-cluster, --kubeconfig-data, a remote --kubeconfig or --decrypt-age")
+	}
+
+	cfg, err := loadConfig(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	clusters, authInfos := findOrphans(&cfg)
+	for _, name := range clusters {
+		fmt.Fprintf(stdout, "cluster\t%s\n", name)
+	}
+	for _, name := range authInfos {
+		fmt.Fprintf(stdout, "authinfo\t%s\n", name)
+	}
+
+	if !opts.pruneOrphans || len(clusters)+len(authInfos) == 0 {
+		return nil
+	}
+
+	loadingRules, err := newLoadingRules(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	// Orphans are determined across the merged config, but each entry is
+	// removed from whichever source file defines it.
+	for _, path := range loadingRules.GetLoadingPrecedence() {
+		fileCfg, err := clientcmd.LoadFromFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to load %q: %w", path, err)
+		}
+
+		var pruned int
+		for _, name := range clusters {
+			if _, ok := fileCfg.Clusters[name]; ok {
+				delete(fileCfg.Clusters, name)
+				pruned++
+			}
+		}
+		for _, name := range authInfos {
+			if _, ok := fileCfg.AuthInfos[name]; ok {
+				delete(fileCfg.AuthInfos, name)
+				pruned++
+			}
+		}
+		if pruned == 0 {
+			continue
+		}
+
+		if opts.dryRun {
+			logger.Printf("would prune %d orphaned entries from %q", pruned, path)
+			continue
+		}
+		if err := writeFileAtomic(path, fileCfg); err != nil {
+			return err
+		}
+		logger.Printf("pruned %d orphaned entries from %q", pruned, path)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// passthroughSource holds the raw source kubeconfig for --passthrough-single,
+// along with how clientcmd writes it, to recognize an exploded context that
+// is the source in all but formatting.
+type passthroughSource struct {
+	raw     []byte
+	written []byte
+}
+
+// loadPassthroughSource returns the raw bytes of the source of cfg for
+// --passthrough-single, or nil if the source isn't a single plain kubeconfig
+// holding only the selected context.
+func loadPassthroughSource(opts *options, cfg *clientcmdapi.Config, todo []string) (*passthroughSource, error) {
+	if len(cfg.Contexts) != 1 || len(todo) != 1 || len(opts.decryptAge) > 0 {
+		return nil, nil
+	}
+
+	var raw []byte
+	if len(opts.kubeconfigData) > 0 {
+		raw = []byte(opts.kubeconfigData)
+	} else {
+		files := sourceFiles(cfg)
+		if len(files) != 1 {
+			return nil, nil
+		}
+		data, err := os.ReadFile(files[0])
+		if os.IsNotExist(err) {
+			// Not a local file, such as a remote --kubeconfig.
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %q: %w", files[0], err)
+		}
+		raw = data
+	}
+
+	parsed, err := clientcmd.Load(raw)
+	if err != nil {
+		return nil, err
+	}
+	written, err := clientcmd.Write(*parsed)
+	if err != nil {
+		return nil, err
+	}
+	return &passthroughSource{raw: raw, written: written}, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// relativeFileRefs returns the certificate, key and token file references of
+// cluster and auth that are still relative.
+//
+// clientcmd resolves relative references against the file each entry was
+// loaded from, so exploded files written elsewhere keep working. Only
+// sources that aren't files, such as --from-keychain or --kubeconfig-data,
+// can leave relative references behind, which are then resolved against the
+// exploded file.
+func relativeFileRefs(cluster *clientcmdapi.Cluster, auth *clientcmdapi.AuthInfo) []string {
+	refs := clientcmd.GetClusterFileReferences(cluster)
+	if auth != nil {
+		refs = append(refs, clientcmd.GetAuthInfoFileReferences(auth)...)
+	}
+
+	var relative []string
+	for _, ref := range refs {
+		if len(*ref) > 0 && !filepath.IsAbs(*ref) {
+			relative = append(relative, *ref)
+		}
+	}
+	return relative
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// Actions recorded in the plan for each selected context.
+const (
+	actionCreate    = "create"
+	actionOverwrite = "overwrite"
+	actionSkip      = "skip"
+	actionStdout    = "stdout"
+	actionMerge     = "merge"
+	actionKeychain  = "keychain"
+)
+
+// Formats accepted by --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// planEntry describes what a run does, or would do under --dry-run, with a
+// single selected context.
+type planEntry struct {
+	Context string `json:"context"`
+	Path    string `json:"path"`
+	Action  string `json:"action"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// printPlan writes plan to w in the --output format, showing paths relative
+// to --relative-to.
+func printPlan(w io.Writer, opts *options, plan []planEntry) error {
+	shown := make([]planEntry, 0, len(plan))
+	for _, entry := range plan {
+		entry.Path = displayPath(opts, entry.Path)
+		shown = append(shown, entry)
+	}
+	plan = shown
+
+	if opts.output == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Contexts []planEntry `json:"contexts"`
+		}{plan})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTEXT\tACTION\tPATH\tREASON")
+	for _, entry := range plan {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.Context, entry.Action, entry.Path, entry.Reason)
+	}
+	return tw.Flush()
+}
+
+// Destination states reported by --preflight.
+const (
+	preflightNew      = "NEW"
+	preflightExists   = "EXISTS"
+	preflightConflict = "CONFLICT"
+)
+
+type preflightEntry struct {
+	Context string `json:"context"`
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+}
+
+// printPreflight reports up front whether each destination is new, already
+// exists with the same content or exists with different content.
+func printPreflight(w io.Writer, opts *options, outputs []output) error {
+	report := make([]preflightEntry, 0, len(outputs))
+	counts := make(map[string]int)
+	for _, out := range outputs {
+		entry := preflightEntry{Context: out.context, Path: out.path, Status: preflightNew}
+		if info, err := os.Stat(out.path); err == nil {
+			entry.Status = preflightConflict
+			if info.Mode().IsRegular() && fileHasContent(out.path, out.content) {
+				entry.Status = preflightExists
+			}
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("unable to stat file %q: %w", out.path, err)
+		}
+		entry.Path = displayPath(opts, entry.Path)
+		report = append(report, entry)
+		counts[entry.Status]++
+	}
+
+	if opts.output == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Destinations []preflightEntry `json:"destinations"`
+		}{report})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCONTEXT\tPATH")
+	for _, entry := range report {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Status, entry.Context, entry.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%d new, %d existing, %d conflicting\n", counts[preflightNew], counts[preflightExists], counts[preflightConflict])
+	return err
+}
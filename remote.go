@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// scpScheme prefixes --kubeconfig values fetched over SSH, in either URL form,
+// scp://user@host:22/path/config, or scp form, scp://user@host:/path/config.
+const scpScheme = "scp://"
+
+func isRemoteKubeconfig(path string) bool {
+	return strings.HasPrefix(path, scpScheme)
+}
+
+// parseSCPPath splits an scp:// --kubeconfig value into the ssh destination,
+// port and remote path.
+func parseSCPPath(value string) (host, port, path string, err error) {
+	rest := strings.TrimPrefix(value, scpScheme)
+
+	// scp form: the remote path follows the first colon of the authority,
+	// unless what follows is a port.
+	authority, _, _ := strings.Cut(rest, "/")
+	if h, p, ok := strings.Cut(authority, ":"); ok && !isPort(p) {
+		host, path = h, strings.TrimPrefix(rest, h+":")
+	} else {
+		u, uerr := url.Parse(value)
+		if uerr != nil {
+			return "", "", "", fmt.Errorf("invalid --kubeconfig %q: %w", value, uerr)
+		}
+		host, port, path = u.Hostname(), u.Port(), u.Path
+		if u.User != nil {
+			host = u.User.Username() + "@" + host
+		}
+	}
+
+	if len(host) == 0 || len(path) == 0 {
+		return "", "", "", fmt.Errorf("invalid --kubeconfig %q, expected scp://[user@]host:/path or scp://[user@]host[:port]/path", value)
+	}
+	return host, port, path, nil
+}
+
+func isPort(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
+
+// loadRemoteKubeconfig fetches and parses a kubeconfig over SSH, checking it
+// against the --input-format format. The system ssh client is used so the
+// user's agent, keys and known_hosts apply.
+func loadRemoteKubeconfig(value, format string) (*clientcmdapi.Config, error) {
+	host, port, path, err := parseSCPPath(value)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-o", "BatchMode=yes"}
+	if len(port) > 0 {
+		args = append(args, "-p", port)
+	}
+	// The remote command is interpreted by the remote shell, so quote the
+	// path unless it relies on ~ expansion.
+	remotePath := shellQuote(path)
+	if home, ok := strings.CutPrefix(path, "~/"); ok {
+		remotePath = "~/" + shellQuote(home)
+	}
+	args = append(args, "--", host, "cat "+remotePath)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("ssh", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("unable to fetch %q: %w: %s", value, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err := checkInputData(format, value, stdout.Bytes()); err != nil {
+		return nil, err
+	}
+
+	cfg, err := clientcmd.Load(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %q: %w", value, err)
+	}
+
+	for _, context := range cfg.Contexts {
+		context.LocationOfOrigin = value
+	}
+	for _, cluster := range cfg.Clusters {
+		cluster.LocationOfOrigin = value
+	}
+	for _, auth := range cfg.AuthInfos {
+		auth.LocationOfOrigin = value
+	}
+	return cfg, nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// renameContext implements the rename subcommand, renaming a context in the
+// source kubeconfig file that defines it and writing that file back.
+func renameContext(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	if len(args) != 2 {
+		return errors.New("usage: rename OLD NEW")
+	}
+	oldName, newName := args[0], args[1]
+
+	loadingRules, err := newLoadingRules(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	path, cfg, err := findContextFile(loadingRules.GetLoadingPrecedence(), oldName)
+	if err != nil {
+		return err
+	}
+
+	if err := renameConfigContext(cfg, oldName, newName, opts.renameKeys); err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		logger.Printf("would rename context %q to %q in %q", oldName, newName, path)
+		return nil
+	}
+
+	if err := writeFileAtomic(path, cfg); err != nil {
+		return err
+	}
+	logger.Printf("renamed context %q to %q in %q", oldName, newName, path)
+
+	return nil
+}
+
+// findContextFile returns the first file in precedence that defines
+// contextName, mirroring how the loader lets the first definition win.
+func findContextFile(precedence []string, contextName string) (string, *clientcmdapi.Config, error) {
+	for _, path := range precedence {
+		cfg, err := clientcmd.LoadFromFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to load %q: %w", path, err)
+		}
+
+		if _, ok := cfg.Contexts[contextName]; ok {
+			return path, cfg, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("could not find context %q", contextName)
+}
+
+// renameConfigContext renames the context oldName to newName in cfg, updating
+// current-context if it pointed at the renamed context. If keys is set, the
+// context's cluster and authinfo are renamed to newName as well and every
+// context referencing them is updated.
+func renameConfigContext(cfg *clientcmdapi.Config, oldName, newName string, keys bool) error {
+	context, ok := cfg.Contexts[oldName]
+	if !ok {
+		return fmt.Errorf("could not find context %q", oldName)
+	}
+	if err := renameKey(cfg.Contexts, oldName, newName, "context"); err != nil {
+		return err
+	}
+
+	if keys {
+		oldCluster, oldAuthInfo := context.Cluster, context.AuthInfo
+		if err := renameKey(cfg.Clusters, oldCluster, newName, "cluster"); err != nil {
+			return err
+		}
+		if err := renameKey(cfg.AuthInfos, oldAuthInfo, newName, "authinfo"); err != nil {
+			return err
+		}
+
+		for _, c := range cfg.Contexts {
+			if c.Cluster == oldCluster {
+				c.Cluster = newName
+			}
+			if c.AuthInfo == oldAuthInfo {
+				c.AuthInfo = newName
+			}
+		}
+	}
+
+	if cfg.CurrentContext == oldName {
+		cfg.CurrentContext = newName
+	}
+
+	return nil
+}
+
+// renameKey moves the entry at oldName in m to newName. Missing entries are
+// left alone.
+func renameKey[T any](m map[string]T, oldName, newName, kind string) error {
+	if oldName == newName {
+		return nil
+	}
+
+	value, ok := m[oldName]
+	if !ok {
+		return nil
+	}
+	if _, ok := m[newName]; ok {
+		return fmt.Errorf("%s %q already exists", kind, newName)
+	}
+
+	delete(m, oldName)
+	m[newName] = value
+
+	return nil
+}
+
+// writeFileAtomic serializes cfg into a temporary file next to path and
+// renames it into place, so readers never observe a partially written file.
+// A symlinked path, such as a ~/.kube/config managed with dotfiles, is
+// resolved so the link is kept and its target replaced. The file keeps its
+// mode.
+func writeFileAtomic(path string, cfg *clientcmdapi.Config) error {
+	content, err := clientcmd.Write(*cfg)
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0600)
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
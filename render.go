@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// renderTemplateData is made available to the --render template.
+type renderTemplateData struct {
+	Name       string
+	Cluster    string
+	Server     string
+	User       string
+	Namespace  string
+	Kubeconfig string
+}
+
+// parseRenderTemplate parses the --render template file.
+func parseRenderTemplate(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read --render template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --render template %q: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// render executes the --render template for out, whose content is the
+// serialized kubeconfig exposed to the template.
+func (e *exploder) render(out output) ([]byte, error) {
+	data := renderTemplateData{Name: out.context, Kubeconfig: string(out.content)}
+	if context := out.cfg.Contexts[out.context]; context != nil {
+		data.Cluster = context.Cluster
+		data.User = context.AuthInfo
+		data.Namespace = context.Namespace
+		if cluster := out.cfg.Clusters[context.Cluster]; cluster != nil {
+			data.Server = cluster.Server
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := e.renderTmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("unable to render --render template for context %q: %w", out.context, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"cmp"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// sharedKeys tracks clusters and authinfos referenced by more than one of the
+// selected contexts for --reuse-keys.
+type sharedKeys struct {
+	dir       string
+	sanitizer sanitizer
+	clusters  map[string]int
+	authInfos map[string]int
+
+	// files are the shared files the exploded configs were rewritten to
+	// reference, keyed by path. They are only written in the emit phase,
+	// along with the configs themselves.
+	files map[string]sharedFile
+
+	// mu serializes extract, which may be called from concurrent prepares.
+	mu sync.Mutex
+}
+
+// sharedFile is a file holding certificate data shared between contexts.
+type sharedFile struct {
+	// context is the first context found referencing the file.
+	context string
+	path    string
+	data    []byte
+}
+
+func newSharedKeys(cfg *clientcmdapi.Config, todo []string, dir string, sanitizer sanitizer) *sharedKeys {
+	s := &sharedKeys{
+		dir:       dir,
+		sanitizer: sanitizer,
+		clusters:  make(map[string]int),
+		authInfos: make(map[string]int),
+		files:     make(map[string]sharedFile),
+	}
+	for _, contextName := range todo {
+		if context := cfg.Contexts[contextName]; context != nil {
+			s.clusters[context.Cluster]++
+			s.authInfos[context.AuthInfo]++
+		}
+	}
+	return s
+}
+
+// extract moves the embedded certificate data of shared clusters and authinfos
+// in the exploded config cfg into dedicated files, rewriting cfg to reference
+// them by path. Nothing is written yet, the files are recorded for pending to
+// return.
+func (s *sharedKeys) extract(cfg *clientcmdapi.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, cluster := range cfg.Clusters {
+		if s.clusters[name] < 2 || len(cluster.CertificateAuthorityData) == 0 {
+			continue
+		}
+
+		cluster = cluster.DeepCopy()
+		path := s.record(cfg.CurrentContext, name+".ca.crt", cluster.CertificateAuthorityData)
+		cluster.CertificateAuthority, cluster.CertificateAuthorityData = path, nil
+		cfg.Clusters[name] = cluster
+	}
+
+	for name, auth := range cfg.AuthInfos {
+		if s.authInfos[name] < 2 || (len(auth.ClientCertificateData) == 0 && len(auth.ClientKeyData) == 0) {
+			continue
+		}
+
+		auth = auth.DeepCopy()
+		if len(auth.ClientCertificateData) > 0 {
+			path := s.record(cfg.CurrentContext, name+".crt", auth.ClientCertificateData)
+			auth.ClientCertificate, auth.ClientCertificateData = path, nil
+		}
+		if len(auth.ClientKeyData) > 0 {
+			path := s.record(cfg.CurrentContext, name+".key", auth.ClientKeyData)
+			auth.ClientKey, auth.ClientKeyData = path, nil
+		}
+		cfg.AuthInfos[name] = auth
+	}
+}
+
+func (s *sharedKeys) record(contextName, name string, data []byte) string {
+	path := filepath.Join(s.dir, s.sanitizer.sanitize(name))
+	if _, ok := s.files[path]; !ok {
+		s.files[path] = sharedFile{context: contextName, path: path, data: data}
+	}
+	return path
+}
+
+// pending returns the recorded shared files sorted by path.
+func (s *sharedKeys) pending() []sharedFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make([]sharedFile, 0, len(s.files))
+	for _, file := range s.files {
+		files = append(files, file)
+	}
+	slices.SortFunc(files, func(a, b sharedFile) int {
+		return cmp.Compare(a.path, b.path)
+	})
+	return files
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+)
+
+// sanitizer turns context, cluster and authinfo names into filenames.
+type sanitizer struct {
+	// replaceChar replaces slashes, which context names commonly contain but
+	// filenames cannot.
+	replaceChar string
+	// lowercase lowercases the whole name.
+	lowercase bool
+}
+
+var defaultSanitizer = sanitizer{replaceChar: "_"}
+
+// sanitizeName derives a filename from name the way the CLI does without
+// --replace-char and --lowercase, e.g. "team/prod" becomes "team_prod".
+func sanitizeName(name string) string {
+	return defaultSanitizer.sanitize(name)
+}
+
+func (s sanitizer) sanitize(name string) string {
+	name = strings.ReplaceAll(name, "/", s.replaceChar)
+	if s.lowercase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// newSanitizer returns the sanitizer configured by --replace-char and
+// --lowercase.
+func newSanitizer(opts *options) sanitizer {
+	return sanitizer{replaceChar: opts.replaceChar, lowercase: opts.lowercase}
+}
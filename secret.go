@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// secretDataKey is the key holding the kubeconfig in --as-secret manifests.
+const secretDataKey = "kubeconfig"
+
+type secretManifest struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   secretMetadata    `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type secretMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// wrapAsSecret wraps the serialized config content in an Opaque Secret
+// manifest named after contextName.
+func wrapAsSecret(contextName, namespace string, content []byte) ([]byte, error) {
+	return encodeYAML(secretManifest{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   secretMetadata{Name: secretName(contextName), Namespace: namespace},
+		Type:       "Opaque",
+		Data:       map[string]string{secretDataKey: base64.StdEncoding.EncodeToString(content)},
+	})
+}
+
+// secretName turns a context name into a valid Secret name by lowercasing it
+// and replacing anything but alphanumerics, '-' and '.' with '-'.
+func secretName(contextName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '-'
+		}
+	}, contextName)
+
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return strings.Trim(name, "-.")
+}
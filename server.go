@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/url"
+	"strings"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// normalizeServer lowercases the scheme and host of a cluster server URL and
+// trims trailing slashes from it. Servers that don't parse are left alone.
+func normalizeServer(server string) string {
+	u, err := url.Parse(server)
+	if err != nil || len(u.Host) == 0 {
+		return server
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+	return u.String()
+}
+
+// warnServerCollisions warns about clusters of the selected contexts that
+// normalize to the same server but trust different certificate authorities,
+// which usually means one of them is stale.
+func warnServerCollisions(cfg *clientcmdapi.Config, todo []string, logger *log.Logger) {
+	byServer := make(map[string]string)
+	for _, contextName := range todo {
+		name := cfg.Contexts[contextName].Cluster
+		cluster := cfg.Clusters[name]
+		if cluster == nil {
+			continue
+		}
+
+		server := normalizeServer(cluster.Server)
+		other, ok := byServer[server]
+		if !ok {
+			byServer[server] = name
+			continue
+		}
+		if other == name {
+			continue
+		}
+
+		otherCluster := cfg.Clusters[other]
+		if otherCluster.CertificateAuthority != cluster.CertificateAuthority || !bytes.Equal(otherCluster.CertificateAuthorityData, cluster.CertificateAuthorityData) {
+			logger.Printf("warning: clusters %q and %q both use server %q but have different certificate authorities", other, name, server)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// stdoutTemplateData is made available to --stdout-header and --stdout-footer.
+type stdoutTemplateData struct {
+	Context string
+}
+
+// parseStdoutTemplate parses the value of a --stdout-header or --stdout-footer
+// flag. An empty value yields a nil template.
+func parseStdoutTemplate(flagName, text string) (*template.Template, error) {
+	if len(text) == 0 {
+		return nil, nil
+	}
+
+	tmpl, err := template.New(flagName).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", flagName, err)
+	}
+	return tmpl, nil
+}
+
+// renderStdoutTemplate renders tmpl for contextName, terminating the result
+// with a newline so it sits on its own line(s) around the config.
+func renderStdoutTemplate(tmpl *template.Template, contextName string) ([]byte, error) {
+	if tmpl == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, stdoutTemplateData{Context: contextName}); err != nil {
+		return nil, fmt.Errorf("unable to render --%s for context %q: %w", tmpl.Name(), contextName, err)
+	}
+	if buf.Len() > 0 && !strings.HasSuffix(buf.String(), "\n") {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// switcherFunction is the name of the shell function --emit-switcher writes.
+const switcherFunction = "kctx"
+
+// writeSwitcher writes a file for bash and zsh to source that defines a kctx
+// function pointing KUBECONFIG at the exploded file of a context, with
+// completion over the contexts of outputs. Contexts exploded into several
+// files with --per-namespace are keyed by file name instead.
+func writeSwitcher(path string, outputs []output) error {
+	counts := make(map[string]int)
+	for _, out := range outputs {
+		counts[out.context]++
+	}
+
+	var names []string
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Generated by kubectl-explode, source this file from your shell profile.\n")
+	fmt.Fprintf(&buf, "%s() {\n\tcase \"$1\" in\n", switcherFunction)
+	for _, out := range outputs {
+		name := out.context
+		if counts[name] > 1 {
+			name = filepath.Base(out.path)
+		}
+		names = append(names, shellQuote(name))
+
+		abs, err := filepath.Abs(out.path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "\t%s) export KUBECONFIG=%s ;;\n", shellQuote(name), shellQuote(abs))
+	}
+	fmt.Fprintf(&buf, "\t'') echo \"usage: %s <context>\" >&2; return 2 ;;\n", switcherFunction)
+	fmt.Fprintf(&buf, "\t*) echo \"%s: unknown context: $1\" >&2; return 1 ;;\n", switcherFunction)
+	fmt.Fprintf(&buf, "\tesac\n}\n\n")
+
+	contexts := strings.Join(names, " ")
+	fmt.Fprintf(&buf, "if [ -n \"$ZSH_VERSION\" ]; then\n")
+	fmt.Fprintf(&buf, "\t_%s() { compadd -- %s; }\n", switcherFunction, contexts)
+	fmt.Fprintf(&buf, "\t(( $+functions[compdef] )) && compdef _%s %s\n", switcherFunction, switcherFunction)
+	fmt.Fprintf(&buf, "elif [ -n \"$BASH_VERSION\" ]; then\n")
+	fmt.Fprintf(&buf, "\t_%s() { COMPREPLY=($(compgen -W %s -- \"${COMP_WORDS[COMP_CWORD]}\")); }\n", switcherFunction, shellQuote(contexts))
+	fmt.Fprintf(&buf, "\tcomplete -F _%s %s\n", switcherFunction, switcherFunction)
+	fmt.Fprintf(&buf, "fi\n")
+
+	return writeFile(path, buf.Bytes(), 0600)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// printToken prints the bearer token the authinfo of a single context
+// authenticates with, running its exec plugin or reading its token file if
+// necessary. Nothing is written to disk.
+func printToken(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	if len(args) != 1 {
+		return errors.New("--print-token requires a single context")
+	}
+	contextName := args[0]
+
+	cfg, err := loadConfig(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	var authFrom *clientcmdapi.Config
+	if len(opts.authFrom) > 0 {
+		authFrom, err = (&clientcmd.ClientConfigLoadingRules{ExplicitPath: opts.authFrom}).Load()
+		if err != nil {
+			return fmt.Errorf("unable to load --auth-from %q: %w", opts.authFrom, err)
+		}
+	}
+
+	outCfg, err := explodeContext(&cfg, authFrom, contextName, opts, logger)
+	if err != nil {
+		return err
+	}
+
+	restCfg, err := clientcmd.NewNonInteractiveClientConfig(*outCfg, contextName, nil, nil).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("context %q: %w", contextName, err)
+	}
+
+	token, err := bearerToken(restCfg)
+	if err != nil {
+		return fmt.Errorf("context %q: %w", contextName, err)
+	}
+
+	logger.Printf("warning: printing the bearer token of context %q in cleartext", contextName)
+	_, err = fmt.Fprintln(stdout, token)
+	return err
+}
+
+// bearerToken returns the token sent in the Authorization header of requests
+// made with cfg. Requests are captured before they leave the process, so
+// this only runs what is needed to obtain credentials, such as exec plugins.
+func bearerToken(cfg *rest.Config) (string, error) {
+	var capture captureRoundTripper
+	rt, err := rest.HTTPWrappersForConfig(cfg, &capture)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, cfg.Host, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := rt.RoundTrip(req); err != nil && !errors.Is(err, errCaptured) {
+		return "", err
+	}
+
+	token, ok := strings.CutPrefix(capture.authorization, "Bearer ")
+	if !ok || len(token) == 0 {
+		return "", errors.New("authinfo does not authenticate with a bearer token")
+	}
+	return token, nil
+}
+
+// errCaptured ends a request captured by captureRoundTripper.
+var errCaptured = errors.New("request captured")
+
+// captureRoundTripper records the Authorization header of a request instead
+// of sending it.
+type captureRoundTripper struct {
+	authorization string
+}
+
+func (c *captureRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.authorization = req.Header.Get("Authorization")
+	return nil, errCaptured
+}
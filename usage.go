@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultLastUsedExtension is the context extension --used-since reads the
+// last-used timestamp from.
+const defaultLastUsedExtension = "last-used"
+
+// parseSince parses a --used-since duration. On top of time.ParseDuration it
+// accepts a whole number of days such as 30d.
+func parseSince(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --used-since %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --used-since %q", s)
+	}
+	return d, nil
+}
+
+// contextLastUsed returns the RFC 3339 timestamp stored in the extension of
+// context, either as the extension itself or in its timestamp field.
+func contextLastUsed(context *clientcmdapi.Context, extension string) (time.Time, bool) {
+	value, ok := extensionString(context.Extensions[extension], "timestamp")
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/url"
+	"slices"
+	"text/tabwriter"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Severities of --validate findings. Only errors fail the run.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// finding is a problem reported by --validate.
+type finding struct {
+	Severity string `json:"severity"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Problem  string `json:"problem"`
+}
+
+// validateConfig checks the structure of the loaded kubeconfig and reports
+// every problem found, failing if any of them is an error.
+func validateConfig(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	cfg, err := loadConfig(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	findings := checkConfig(&cfg)
+
+	switch opts.output {
+	case outputText:
+		if err := printFindings(stdout, findings); err != nil {
+			return err
+		}
+	case outputJSON:
+		if err := printJSON(stdout, findings); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid --output %q, must be %s or %s", opts.output, outputText, outputJSON)
+	}
+
+	var errs int
+	for _, f := range findings {
+		if f.Severity == severityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("found %d errors in the kubeconfig", errs)
+	}
+	return nil
+}
+
+// checkConfig returns the problems of cfg, errors first.
+func checkConfig(cfg *clientcmdapi.Config) []finding {
+	var findings []finding
+	report := func(severity, kind, name, format string, a ...any) {
+		findings = append(findings, finding{Severity: severity, Kind: kind, Name: name, Problem: fmt.Sprintf(format, a...)})
+	}
+
+	if len(cfg.CurrentContext) > 0 && cfg.Contexts[cfg.CurrentContext] == nil {
+		report(severityWarning, "config", "current-context", "references missing context %q", cfg.CurrentContext)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Contexts)) {
+		context := cfg.Contexts[name]
+		if context == nil {
+			report(severityError, "context", name, "is empty")
+			continue
+		}
+		if _, ok := cfg.Clusters[context.Cluster]; !ok {
+			report(severityError, "context", name, "references missing cluster %q", context.Cluster)
+		}
+		if _, ok := cfg.AuthInfos[context.AuthInfo]; !ok {
+			report(severityError, "context", name, "references missing authinfo %q", context.AuthInfo)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Clusters)) {
+		cluster := cfg.Clusters[name]
+		if cluster == nil || len(cluster.Server) == 0 {
+			report(severityError, "cluster", name, "has no server")
+			continue
+		}
+		if u, err := url.Parse(cluster.Server); err != nil {
+			report(severityError, "cluster", name, "has an invalid server %q", cluster.Server)
+		} else if u.Scheme == "http" {
+			report(severityWarning, "cluster", name, "uses an unencrypted http server")
+		}
+		if cluster.InsecureSkipTLSVerify {
+			report(severityWarning, "cluster", name, "uses insecure-skip-tls-verify")
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.AuthInfos)) {
+		auth := cfg.AuthInfos[name]
+		if auth == nil || len(authInfoMethods(auth)) == 0 {
+			report(severityWarning, "authinfo", name, "has no credentials")
+		}
+	}
+
+	clusters, authInfos := findOrphans(cfg)
+	for _, name := range clusters {
+		report(severityWarning, "cluster", name, "is not referenced by any context")
+	}
+	for _, name := range authInfos {
+		report(severityWarning, "authinfo", name, "is not referenced by any context")
+	}
+
+	slices.SortStableFunc(findings, func(a, b finding) int {
+		return severityRank(a.Severity) - severityRank(b.Severity)
+	})
+	return findings
+}
+
+func severityRank(severity string) int {
+	if severity == severityError {
+		return 0
+	}
+	return 1
+}
+
+// printFindings writes findings to w as a table followed by their counts.
+func printFindings(w io.Writer, findings []finding) error {
+	counts := make(map[string]int)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEVERITY\tKIND\tNAME\tPROBLEM")
+	for _, f := range findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Severity, f.Kind, f.Name, f.Problem)
+		counts[f.Severity]++
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%d errors, %d warnings\n", counts[severityError], counts[severityWarning])
+	return err
+}
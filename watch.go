@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the source has to be quiet before re-exploding,
+// so a burst of writes from a cloud CLI results in a single sync.
+const watchDebounce = 500 * time.Millisecond
+
+// watch explodes once and then again every time one of the source kubeconfig
+// files changes, until interrupted. Exploded files whose content changed are
+// overwritten, while unchanged ones are left alone.
+func watch(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	opts.skipUnchanged = true
+	// Keeping files in sync means replacing outdated ones, unless the user
+	// asked for another way of handling existing files.
+	if !opts.replace && !opts.noClobberDifferent && !opts.failOnOverwrite {
+		opts.force = true
+	}
+
+	if err := watchSync(opts, args, stdout, logger); err != nil {
+		return err
+	}
+
+	dirs, files, err := watchTargets(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("unable to watch %q: %w", dir, err)
+		}
+	}
+	logger.Printf("watching %d directories for changes", len(dirs))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	debounce := time.NewTimer(0)
+	<-debounce.C
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Print("stopping watch")
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if files == nil || files[event.Name] {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Printf("watch error: %v", err)
+		case <-debounce.C:
+			if err := watchSync(opts, args, stdout, logger); err != nil {
+				logger.Printf("sync failed: %v", err)
+			}
+		}
+	}
+}
+
+// watchSync explodes args once, logging how many files had to be updated.
+func watchSync(opts *options, args []string, stdout io.Writer, logger *log.Logger) error {
+	e := &exploder{opts: opts, stdout: stdout, logger: logger}
+	if err := e.run(args); err != nil {
+		return err
+	}
+
+	switch {
+	case opts.stdout || opts.keychain:
+		logger.Print("synced exploded contexts")
+	case len(e.written) == 0:
+		logger.Print("exploded files are already up to date")
+	default:
+		logger.Printf("synced %d exploded files", len(e.written))
+	}
+	return nil
+}
+
+// watchTargets returns the directories to watch and the files within them
+// whose changes trigger a sync. A nil set of files means any change does.
+//
+// Source files are watched through their parent directories because many
+// tools replace the config through a rename, which would otherwise silently
+// end a watch on the file itself.
+func watchTargets(opts *options, logger *log.Logger) ([]string, map[string]bool, error) {
+	if opts.inCluster {
+		return nil, nil, errors.New("--watch cannot be used with --in-cluster")
+	}
+
+	if len(opts.kubeconfigDir) > 0 {
+		dir, err := filepath.Abs(opts.kubeconfigDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []string{dir}, nil, nil
+	}
+
+	loadingRules, err := newLoadingRules(opts, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dirs []string
+	files := make(map[string]bool)
+	for _, path := range loadingRules.GetLoadingPrecedence() {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if dir := filepath.Dir(abs); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+		files[abs] = true
+	}
+
+	return dirs, files, nil
+}
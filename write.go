@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// planWrite decides what writing content for contextName to path would do,
+// honoring --force, --replace-existing, --no-clobber-different and
+// --fail-on-overwrite when the destination already exists.
+func planWrite(opts *options, contextName, path string, content []byte) (planEntry, error) {
+	entry := planEntry{Context: contextName, Path: path, Action: actionCreate}
+
+	if info, err := os.Stat(path); err == nil {
+		switch {
+		case info.Mode()&os.ModeNamedPipe != 0:
+			// Stream through named pipes instead of treating them as an
+			// existing file that must not be clobbered.
+			entry.Reason = "is a named pipe, writing through it"
+		case !info.Mode().IsRegular():
+			return entry, fmt.Errorf("destination %q is not a regular file", path)
+		case opts.failOnOverwrite:
+			return entry, fmt.Errorf("file %q already exists and --fail-on-overwrite is set", path)
+		case (opts.skipUnchanged || opts.noClobberDifferent) && fileHasContent(path, content):
+			entry.Action = actionSkip
+			entry.Reason = "is already up to date"
+		case opts.noClobberDifferent:
+			return entry, fmt.Errorf("file %q already exists with different content, reconcile it manually or remove it", path)
+		case opts.replace:
+			entry.Action = actionOverwrite
+			entry.Reason = "already exists, replacing it due to --replace-existing"
+		case opts.force:
+			entry.Action = actionOverwrite
+			entry.Reason = "already exists, overwriting it due to --force"
+		default:
+			entry.Action = actionSkip
+			entry.Reason = "already exists, use --force to overwrite"
+		}
+	} else if !os.IsNotExist(err) {
+		return entry, fmt.Errorf("unable to stat file %q: %w", path, err)
+	}
+
+	return entry, nil
+}
+
+// writeConfig carries out a planned write of the serialized config content
+// with the file mode mode.
+func writeConfig(opts *options, entry planEntry, content []byte, mode os.FileMode, logger *log.Logger) error {
+	switch entry.Action {
+	case actionSkip:
+		logger.Printf("file %q %s", displayPath(opts, entry.Path), entry.Reason)
+		if opts.showDiffOnSkip {
+			logSkipDiff(entry.Path, displayPath(opts, entry.Path), content, logger)
+		}
+		return nil
+	case actionOverwrite:
+		if opts.replace {
+			// Removing first lets us write files whose existing permissions or
+			// attributes would prevent them from being truncated in place.
+			if err := os.Remove(entry.Path); err != nil {
+				return fmt.Errorf("unable to remove file %q: %w", entry.Path, err)
+			}
+		}
+	}
+
+	return writeWithRetries(opts.writeRetries, logger, func() error {
+		return writeFile(entry.Path, content, mode)
+	})
+}
+
+// transientWriteErrors are the errors worth retrying a write for, as they are
+// commonly seen on flaky network filesystems and tend to go away.
+var transientWriteErrors = []error{syscall.EINTR, syscall.EAGAIN, syscall.EBUSY, syscall.EIO, syscall.ENOSPC, syscall.ETIMEDOUT}
+
+func isTransientWriteError(err error) bool {
+	return slices.ContainsFunc(transientWriteErrors, func(target error) bool {
+		return errors.Is(err, target)
+	})
+}
+
+// writeRetryDelay is the delay before the first retry, doubling for each
+// subsequent one.
+const writeRetryDelay = 100 * time.Millisecond
+
+// writeWithRetries calls write, retrying up to retries times with exponential
+// backoff for as long as it fails with a transient error. Any other error,
+// such as a permission problem, is returned immediately.
+func writeWithRetries(retries int, logger *log.Logger, write func() error) error {
+	delay := writeRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if err == nil || attempt >= retries || !isTransientWriteError(err) {
+			return err
+		}
+
+		logger.Printf("%v, retrying in %s", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// checkSourceOverwrites fails if any of the destinations, which map the paths
+// outputs end up at to their context, is one of the files the source config
+// cfg was loaded from, such as a context named config exploded next to
+// ~/.kube/config.
+func checkSourceOverwrites(cfg *clientcmdapi.Config, destinations map[string]string) error {
+	sources := make(map[string]os.FileInfo)
+	for _, path := range sourceFiles(cfg) {
+		if info, err := os.Stat(path); err == nil {
+			sources[path] = info
+		}
+	}
+
+	for _, dest := range slices.Sorted(maps.Keys(destinations)) {
+		info, err := os.Stat(dest)
+		if err != nil {
+			continue
+		}
+		for path, source := range sources {
+			if os.SameFile(info, source) {
+				return fmt.Errorf("context %q would overwrite the source kubeconfig %q, use --allow-overwrite-source to write it anyway", destinations[dest], path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sourceFiles returns the files the entries of cfg were loaded from.
+func sourceFiles(cfg *clientcmdapi.Config) []string {
+	files := make(map[string]bool)
+	for _, context := range cfg.Contexts {
+		files[context.LocationOfOrigin] = true
+	}
+	for _, cluster := range cfg.Clusters {
+		files[cluster.LocationOfOrigin] = true
+	}
+	for _, auth := range cfg.AuthInfos {
+		files[auth.LocationOfOrigin] = true
+	}
+	delete(files, "")
+
+	return slices.Sorted(maps.Keys(files))
+}
+
+// fileHasContent reports whether the file at path already holds content.
+func fileHasContent(path string, content []byte) bool {
+	existing, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(existing, content)
+}
+
+// writeFile writes content to path the same way clientcmd.WriteToFile does,
+// except that missing parent directories such as ~/.kube on a fresh machine
+// are created readable by the owner only, since they hold credentials. A
+// regular file ends up with mode, even if it already existed, while the
+// permissions of something like a named pipe are left alone.
+func writeFile(path string, content []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("unable to create directory %q: %w", dir, err)
+		}
+	}
+
+	if err := os.WriteFile(path, content, mode); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// defaultModeExtension is the context extension --mode-extension reads a
+// per-context file mode from.
+const defaultModeExtension = "file-mode"
+
+// parseFileMode parses an octal file mode such as 0600 or 400.
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q, must be octal permissions such as 0600", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// Context fields accepted by --name-from.
+const (
+	nameFromContext   = "context"
+	nameFromCluster   = "cluster"
+	nameFromUser      = "user"
+	nameFromNamespace = "namespace"
+)
+
+var nameFields = []string{nameFromContext, nameFromCluster, nameFromUser, nameFromNamespace}
+
+// fileNames returns the names the files of the contexts in todo are derived
+// from, taken from the field of each context selected by --name-from.
+func fileNames(cfg *clientcmdapi.Config, todo []string, opts *options) (map[string]string, error) {
+	names := make(map[string]string, len(todo))
+	for _, contextName := range todo {
+		context := cfg.Contexts[contextName]
+
+		var name string
+		switch opts.nameFrom {
+		case nameFromContext:
+			name = contextName
+		case nameFromCluster:
+			name = context.Cluster
+		case nameFromUser:
+			name = context.AuthInfo
+		case nameFromNamespace:
+			name = cmp.Or(context.Namespace, opts.defaultNamespace)
+		}
+		if len(name) == 0 {
+			return nil, fmt.Errorf("context %q has no %s to name its file after with --name-from", contextName, opts.nameFrom)
+		}
+		names[contextName] = name
+	}
+	return names, nil
+}
+
+// destinationPath returns the file an exploded context whose file is named
+// after name is written to.
+func destinationPath(opts *options, name string) string {
+	for _, prefix := range opts.stripPrefixes {
+		if stripped, ok := strings.CutPrefix(name, prefix); ok && len(stripped) > 0 {
+			name = stripped
+			break
+		}
+	}
+
+	return filepath.Join(outputDir(), newSanitizer(opts).sanitize(name))
+}
+
+// displayPath returns path as shown in logs and reports, which is relative to
+// --relative-to if set and path is below it. Files are always written to the
+// path itself.
+func displayPath(opts *options, path string) string {
+	if len(opts.relativeTo) == 0 {
+		return path
+	}
+
+	base, err := filepath.Abs(opts.relativeTo)
+	if err != nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// outputDir returns the directory exploded files are written to. This is
+// $XDG_CONFIG_HOME/kube when XDG_CONFIG_HOME is set and that directory
+// exists, and ~/.kube otherwise.
+func outputDir() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); len(xdg) > 0 {
+		dir := filepath.Join(xdg, "kube")
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+
+	return clientcmd.RecommendedConfigDir
+}
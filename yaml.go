@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// encodeYAML marshals v as YAML using the two-space indentation clientcmd uses.
+func encodeYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlComment turns text into YAML comment lines, prefixing every line that
+// isn't already a comment with "# ". Empty text yields no comment.
+func yamlComment(text string) []byte {
+	text = strings.TrimRight(text, "\n")
+	if len(text) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case len(line) == 0:
+			line = "#"
+		default:
+			line = "# " + line
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}